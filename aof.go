@@ -0,0 +1,397 @@
+package xcache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"github.com/pubgo/xerror"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// FsyncPolicy AOF的fsync策略
+type FsyncPolicy uint8
+
+const (
+	// FsyncEverySecond 每秒fsync一次, 默认策略
+	FsyncEverySecond FsyncPolicy = iota
+	// FsyncAlways 每次写入都fsync
+	FsyncAlways
+	// FsyncNever 只写入操作系统, 不主动fsync
+	FsyncNever
+)
+
+// AOF的操作类型
+const (
+	aofSet byte = iota + 1
+	aofDel
+	aofExpire
+	// 带flags的写入, flags为0的时候使用aofSet, 兼容没有flags的AOF文件
+	aofSetFlags
+	aofFlush
+)
+
+// AOF record: op(1) | keyLen(uvarint) | valLen(uvarint) | expireAt(uvarint) | [flags(uvarint)] | key | val | crc32(4)
+// 只有aofSetFlags有flags字段
+// crc32覆盖record中除crc32之外的所有字节, 重放遇到损坏的record会截断文件
+type aof struct {
+	mu     sync.Mutex
+	path   string
+	f      *os.File
+	policy FsyncPolicy
+	buf    []byte
+	err    error
+	stop   chan struct{}
+	closed bool
+
+	// size 当前文件大小, baseSize 上一次重写之后的文件大小
+	size     int64
+	baseSize int64
+
+	// 重写期间的写入会同时追加到rewriteBuf, 重写完成之后写入新文件
+	rewriting  bool
+	rewriteBuf []byte
+}
+
+// initAOF 重放AOF文件恢复数据, 然后打开文件追加写入
+func (x *xcache) initAOF() (err error) {
+	defer xerror.RespErr(&err)
+
+	if x.opts.AOFPath == "" || x.aof != nil {
+		return nil
+	}
+
+	f, err := os.OpenFile(x.opts.AOFPath, os.O_RDWR|os.O_CREATE, 0644)
+	xerror.Panic(err)
+
+	size, err := x.replayAOF(f)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	// 截断损坏的部分
+	xerror.Panic(f.Truncate(size))
+	_, err = f.Seek(size, io.SeekStart)
+	xerror.Panic(err)
+
+	a := &aof{
+		path:     x.opts.AOFPath,
+		f:        f,
+		policy:   x.opts.AOFSync,
+		size:     size,
+		baseSize: size,
+		stop:     make(chan struct{}),
+	}
+
+	if a.policy == FsyncEverySecond {
+		go a.syncEverySecond()
+	}
+
+	x.aof = a
+	return nil
+}
+
+// replayAOF 重放AOF文件, 返回最后一条完整record的结束位置
+func (x *xcache) replayAOF(f *os.File) (int64, error) {
+	var cr = &crcReader{r: bufio.NewReader(f), h: crc32.New(crcTable)}
+	var now = time.Now().UnixNano()
+	var offset int64
+
+	for {
+		cr.h.Reset()
+		n, op, key, val, expireAt, flags, err := readAOFRecord(cr)
+		if err != nil {
+			// 文件末尾不完整或者损坏的record, 从上一条完整的record处截断
+			return offset, nil
+		}
+		offset += n
+
+		switch op {
+		case aofSet, aofSetFlags:
+			if expireAt <= now {
+				x.replayDel(key)
+				continue
+			}
+
+			ent, err := x.newEntryAt(key, val, expireAt)
+			if err != nil {
+				continue
+			}
+			ent.itm.flags = flags
+
+			s := x.shard(ent.h1)
+			s.mu.Lock()
+			_ = x.setItem(s, ent)
+			s.mu.Unlock()
+		case aofDel, aofExpire:
+			x.replayDel(key)
+		case aofFlush:
+			x.flush()
+		}
+	}
+}
+
+func (x *xcache) replayDel(key []byte) {
+	if x.checkKey(len(key)) != nil {
+		return
+	}
+
+	h1 := x.hashKey(key)
+	s := x.shard(h1)
+	s.mu.Lock()
+	x.delItem(s, key, h1)
+	s.mu.Unlock()
+}
+
+func readAOFRecord(cr *crcReader) (n int64, op byte, key, val []byte, expireAt int64, flags uint32, err error) {
+	defer xerror.RespErr(&err)
+
+	op, err = cr.ReadByte()
+	xerror.Panic(err)
+
+	keyLen, err := binary.ReadUvarint(cr)
+	xerror.Panic(err)
+
+	valLen, err := binary.ReadUvarint(cr)
+	xerror.Panic(err)
+
+	exp, err := binary.ReadUvarint(cr)
+	xerror.Panic(err)
+
+	var fl uint64
+	if op == aofSetFlags {
+		fl, err = binary.ReadUvarint(cr)
+		xerror.Panic(err)
+	}
+
+	if op < aofSet || op > aofFlush || keyLen+valLen > maxSnapshotRecord || fl > 1<<32-1 {
+		return 0, 0, nil, nil, 0, 0, xerror.WrapF(ErrAOF, "op: %d, size: %d", op, keyLen+valLen)
+	}
+
+	var dt = make([]byte, keyLen+valLen)
+	_, err = io.ReadFull(cr, dt)
+	xerror.Panic(err)
+
+	sum := cr.h.Sum32()
+	var crc [4]byte
+	_, err = io.ReadFull(cr.r, crc[:])
+	xerror.Panic(err)
+
+	if binary.BigEndian.Uint32(crc[:]) != sum {
+		return 0, 0, nil, nil, 0, 0, xerror.WrapF(ErrAOF, "checksum mismatch")
+	}
+
+	n = 1 + int64(uvarintLen(keyLen)+uvarintLen(valLen)+uvarintLen(exp)) + int64(len(dt)) + 4
+	if op == aofSetFlags {
+		n += int64(uvarintLen(fl))
+	}
+	return n, op, dt[:keyLen], dt[keyLen:], int64(exp), uint32(fl), nil
+}
+
+func uvarintLen(v uint64) int {
+	var tmp [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(tmp[:], v)
+}
+
+func appendAOFRecord(buf []byte, op byte, key, val []byte, expireAt int64, flags uint32) []byte {
+	var start = len(buf)
+	buf = append(buf, op)
+	buf = appendUvarint(buf, uint64(len(key)))
+	buf = appendUvarint(buf, uint64(len(val)))
+	buf = appendUvarint(buf, uint64(expireAt))
+	if op == aofSetFlags {
+		buf = appendUvarint(buf, uint64(flags))
+	}
+	buf = append(buf, key...)
+	buf = append(buf, val...)
+
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc32.Checksum(buf[start:], crcTable))
+	return append(buf, sum[:]...)
+}
+
+// append 追加一条record, a为nil的时候不做任何事情
+func (a *aof) append(op byte, key, val []byte, expireAt int64, flags uint32) {
+	if a == nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.closed {
+		return
+	}
+
+	a.buf = appendAOFRecord(a.buf[:0], op, key, val, expireAt, flags)
+	if a.rewriting {
+		a.rewriteBuf = append(a.rewriteBuf, a.buf...)
+	}
+
+	n, err := a.f.Write(a.buf)
+	a.size += int64(n)
+	if err == nil && a.policy == FsyncAlways {
+		err = a.f.Sync()
+	}
+
+	if err != nil && a.err == nil {
+		a.err = err
+	}
+}
+
+// needRewrite 文件比上一次重写之后增长超过AOFRewriteSize
+func (a *aof) needRewrite(rewriteSize int64) bool {
+	if a == nil || rewriteSize <= 0 {
+		return false
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return !a.rewriting && a.size-a.baseSize > rewriteSize
+}
+
+func (a *aof) syncEverySecond() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			a.mu.Lock()
+			if err := a.f.Sync(); err != nil && a.err == nil && !a.closed {
+				a.err = err
+			}
+			a.mu.Unlock()
+		case <-a.stop:
+			return
+		}
+	}
+}
+
+// aofSet 记录写入, 调用方需要持有s.mu
+func (x *xcache) aofSet(key, val []byte, expireAt int64, flags uint32) {
+	if x.aof == nil {
+		return
+	}
+
+	x.aof.append(aofSetOp(flags), key, val, expireAt, flags)
+	if x.aof.needRewrite(x.opts.AOFRewriteSize) {
+		go func() {
+			_ = x.RewriteAOF()
+		}()
+	}
+}
+
+// aofDel 记录删除, 过期和淘汰, 调用方需要持有s.mu
+func (x *xcache) aofDel(op byte, key []byte) {
+	x.aof.append(op, key, nil, 0, 0)
+}
+
+func aofSetOp(flags uint32) byte {
+	if flags != 0 {
+		return aofSetFlags
+	}
+	return aofSet
+}
+
+// RewriteAOF 用当前的数据生成最小的AOF文件, 每个分片只在复制数据引用的时候持有读锁
+func (x *xcache) RewriteAOF() (err error) {
+	defer xerror.RespErr(&err)
+
+	a := x.aof
+	if a == nil {
+		return nil
+	}
+
+	a.mu.Lock()
+	if a.rewriting {
+		a.mu.Unlock()
+		return nil
+	}
+	a.rewriting = true
+	a.rewriteBuf = nil
+	a.mu.Unlock()
+
+	defer func() {
+		a.mu.Lock()
+		a.rewriting = false
+		a.rewriteBuf = nil
+		a.mu.Unlock()
+	}()
+
+	tmp := a.path + ".rewrite"
+	f, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	xerror.Panic(err)
+	defer func() {
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(tmp)
+		}
+	}()
+
+	var w = bufio.NewWriter(f)
+	var now = time.Now().UnixNano()
+	var buf []byte
+	var size int64
+	for _, s := range x.shards {
+		for _, ent := range x.snapshotShard(s, now) {
+			buf = appendAOFRecord(buf[:0], aofSetOp(ent.flags), ent.key, ent.val, now+ent.ttl, ent.flags)
+			_, err = w.Write(buf)
+			xerror.Panic(err)
+			size += int64(len(buf))
+		}
+	}
+	xerror.Panic(w.Flush())
+
+	// 重写期间的写入追加到新文件, 然后替换旧文件
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.closed {
+		return xerror.WrapF(ErrAOF, "closed")
+	}
+
+	n, err := f.Write(a.rewriteBuf)
+	xerror.Panic(err)
+	xerror.Panic(f.Sync())
+	xerror.Panic(os.Rename(tmp, a.path))
+
+	_ = a.f.Close()
+	a.f = f
+	a.size = size + int64(n)
+	a.baseSize = a.size
+	return nil
+}
+
+// Close 关闭AOF文件, 返回AOF写入过程中的第一个错误
+func (x *xcache) Close() error {
+	a := x.aof
+	if a == nil {
+		return nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.closed {
+		return a.err
+	}
+	a.closed = true
+
+	if a.policy == FsyncEverySecond {
+		close(a.stop)
+	}
+
+	err := a.f.Sync()
+	if cErr := a.f.Close(); err == nil {
+		err = cErr
+	}
+
+	if a.err != nil {
+		err = a.err
+	}
+	return err
+}
@@ -0,0 +1,90 @@
+package xcache
+
+import (
+	"fmt"
+	"github.com/pubgo/xerror"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAOF(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xcache")
+	xerror.Panic(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "xcache.aof")
+	x := xerror.PanicErr(New(WithAOF(path, FsyncAlways))).(*xcache)
+	for i := 0; i < 100; i++ {
+		key := []byte(fmt.Sprintf("aof_%d", i))
+		xerror.Panic(x.Set(key, key, time.Second*10))
+	}
+	xerror.Panic(x.Delete([]byte("aof_1")))
+	xerror.Panic(x.Set([]byte("aof_2"), []byte("new"), time.Second*10))
+	xerror.Panic(x.Close())
+
+	y := xerror.PanicErr(New(WithAOF(path, FsyncAlways))).(*xcache)
+	if y.Count() != 99 {
+		t.Fatalf("expected 99 items, got %d", y.Count())
+	}
+	if _, err := y.Get([]byte("aof_1")); err == nil {
+		t.Fatal("expected the deleted key to stay deleted")
+	}
+	val, err := y.Get([]byte("aof_2"))
+	xerror.Panic(err)
+	if string(val) != "new" {
+		t.Fatalf("unexpected value %s", val)
+	}
+
+	// 重写之后文件变小, 重写期间的写入不会丢失
+	before, err := os.Stat(path)
+	xerror.Panic(err)
+	xerror.Panic(y.RewriteAOF())
+	xerror.Panic(y.Set([]byte("aof_100"), []byte("aof_100"), time.Second*10))
+	after, err := os.Stat(path)
+	xerror.Panic(err)
+	if after.Size() >= before.Size() {
+		t.Fatalf("expected the rewritten log to shrink, %d >= %d", after.Size(), before.Size())
+	}
+	xerror.Panic(y.Close())
+
+	z := xerror.PanicErr(New(WithAOF(path, FsyncNever))).(*xcache)
+	if z.Count() != 100 {
+		t.Fatalf("expected 100 items after rewrite, got %d", z.Count())
+	}
+	xerror.Panic(z.Close())
+}
+
+func TestAOFTruncate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xcache")
+	xerror.Panic(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "xcache.aof")
+	x := xerror.PanicErr(New(WithAOF(path, FsyncAlways))).(*xcache)
+	for i := 0; i < 10; i++ {
+		key := []byte(fmt.Sprintf("aof_%d", i))
+		xerror.Panic(x.Set(key, key, time.Second*10))
+	}
+	xerror.Panic(x.Close())
+
+	// 模拟写到一半的record
+	info, err := os.Stat(path)
+	xerror.Panic(err)
+	xerror.Panic(os.Truncate(path, info.Size()-3))
+
+	y := xerror.PanicErr(New(WithAOF(path, FsyncAlways))).(*xcache)
+	if y.Count() != 9 {
+		t.Fatalf("expected 9 items, got %d", y.Count())
+	}
+	xerror.Panic(y.Set([]byte("aof_9"), []byte("aof_9"), time.Second*10))
+	xerror.Panic(y.Close())
+
+	z := xerror.PanicErr(New(WithAOF(path, FsyncAlways))).(*xcache)
+	if z.Count() != 10 {
+		t.Fatalf("expected 10 items, got %d", z.Count())
+	}
+	xerror.Panic(z.Close())
+}
@@ -0,0 +1,291 @@
+package xcache
+
+import (
+	"context"
+	"errors"
+	"github.com/pubgo/xerror"
+	"time"
+)
+
+// MGet 批量获取数据, 返回的数据和错误跟keys一一对应
+func (x *xcache) MGet(keys [][]byte) ([][]byte, []error) {
+	return x.MGetCtx(context.Background(), keys)
+}
+
+// MGetCtx ...
+func (x *xcache) MGetCtx(ctx context.Context, keys [][]byte) ([][]byte, []error) {
+	return x.mget(ctx, keys, nil)
+}
+
+// mget negative不为nil的时候记录哪些key是不存在的标记
+func (x *xcache) mget(ctx context.Context, keys [][]byte, negative []bool) ([][]byte, []error) {
+	var vals = make([][]byte, len(keys))
+	var errs = make([]error, len(keys))
+	if err := ctx.Err(); err != nil {
+		return vals, fillErr(errs, err)
+	}
+
+	hs := x.hashKeys(keys, errs)
+	for si, group := range x.groupByShard(hs, errs) {
+		if len(group) == 0 {
+			continue
+		}
+
+		var s = x.shards[si]
+		var expKeys, slideKeys [][]byte
+		var expHs, slideHs []uint32
+		s.mu.RLock()
+		for _, i := range group {
+			x.record(keys[i])
+			dt, itm, existed, expired := x.getItem(s, keys[i], hs[i])
+			if existed {
+				vals[i] = dt
+				if itm.mode != ExpireAbsolute {
+					slideKeys = append(slideKeys, keys[i])
+					slideHs = append(slideHs, hs[i])
+				}
+				continue
+			}
+
+			if negative != nil {
+				negative[i] = itm.negative && !expired
+			}
+
+			if expired {
+				expKeys = append(expKeys, keys[i])
+				expHs = append(expHs, hs[i])
+			}
+			errs[i] = xerror.WrapF(ErrKeyNotFound, "key: %s", keys[i])
+		}
+		s.mu.RUnlock()
+
+		if len(slideKeys) > 0 {
+			x.slide(s, slideKeys, slideHs)
+		}
+
+		if len(expKeys) > 0 {
+			// 惰性过期清理
+			go x.lazyExpire(s, expKeys, expHs)
+		}
+	}
+
+	return vals, errs
+}
+
+// MSet 批量写入数据, 返回的错误跟keys一一对应
+func (x *xcache) MSet(keys, vals [][]byte, e time.Duration) []error {
+	return x.MSetCtx(context.Background(), keys, vals, e)
+}
+
+// MSetCtx ...
+func (x *xcache) MSetCtx(ctx context.Context, keys, vals [][]byte, e time.Duration) []error {
+	var errs = make([]error, len(keys))
+	if err := ctx.Err(); err != nil {
+		return fillErr(errs, err)
+	}
+
+	if len(keys) != len(vals) {
+		return fillErr(errs, xerror.WrapF(ErrLength, "keys: %d, values: %d", len(keys), len(vals)))
+	}
+
+	var ents = make([]entry, len(keys))
+	for i := range keys {
+		ents[i], errs[i] = x.newEntry(keys[i], vals[i], e)
+	}
+
+	x.setEntries(ents, errs)
+	return errs
+}
+
+// MDelete 批量删除数据, 返回的错误跟keys一一对应
+func (x *xcache) MDelete(keys [][]byte) []error {
+	return x.MDeleteCtx(context.Background(), keys)
+}
+
+// MDeleteCtx ...
+func (x *xcache) MDeleteCtx(ctx context.Context, keys [][]byte) []error {
+	var errs = make([]error, len(keys))
+	if err := ctx.Err(); err != nil {
+		return fillErr(errs, err)
+	}
+
+	hs := x.hashKeys(keys, errs)
+	for si, group := range x.groupByShard(hs, errs) {
+		if len(group) == 0 {
+			continue
+		}
+
+		var s = x.shards[si]
+		s.mu.Lock()
+		for _, i := range group {
+			if !x.delItem(s, keys[i], hs[i]) {
+				errs[i] = xerror.WrapF(ErrKeyNotFound, "key: %s", keys[i])
+				continue
+			}
+			s.stats.deletes.Inc()
+		}
+		s.mu.Unlock()
+	}
+	return errs
+}
+
+// MGetWithDataLoad 批量获取数据, 不存在的key会一次性交给fn加载
+// fn返回的数据需要跟传入的keys一一对应
+func (x *xcache) MGetWithDataLoad(keys [][]byte, e time.Duration, fn func(keys [][]byte) ([][]byte, error)) ([][]byte, []error) {
+	var load func(context.Context, [][]byte) ([][]byte, error)
+	if fn != nil {
+		load = func(_ context.Context, keys [][]byte) ([][]byte, error) {
+			return fn(keys)
+		}
+	}
+	return x.MGetWithDataLoadCtx(context.Background(), keys, e, load)
+}
+
+// MGetWithDataLoadCtx ...
+func (x *xcache) MGetWithDataLoadCtx(ctx context.Context, keys [][]byte, e time.Duration, fn func(ctx context.Context, keys [][]byte) ([][]byte, error)) ([][]byte, []error) {
+	var negative = make([]bool, len(keys))
+	vals, errs := x.mget(ctx, keys, negative)
+	if fn == nil {
+		return vals, errs
+	}
+
+	var missing []int
+	for i, err := range errs {
+		// 不存在的标记和布隆过滤器中一定不存在的key不加载
+		if errors.Is(err, ErrKeyNotFound) && !negative[i] && x.mayExist(keys[i]) {
+			missing = append(missing, i)
+		}
+	}
+
+	if len(missing) == 0 {
+		return vals, errs
+	}
+
+	var missKeys = make([][]byte, len(missing))
+	for j, i := range missing {
+		missKeys[j] = keys[i]
+	}
+
+	dts, err := x.loadBatch(ctx, missKeys, fn)
+	if err == nil && len(dts) != len(missKeys) {
+		err = xerror.WrapF(ErrLength, "keys: %d, values: %d", len(missKeys), len(dts))
+	}
+
+	if errors.Is(err, ErrNotExist) {
+		// 所有加载的key都不存在
+		for _, i := range missing {
+			errs[i] = xerror.WrapF(ErrKeyNotFound, "key: %s", keys[i])
+			if err := x.setNegative(keys[i]); err != nil && !errors.Is(err, ErrAdmissionRejected) {
+				errs[i] = err
+			}
+		}
+		return vals, errs
+	}
+
+	if err != nil {
+		for _, i := range missing {
+			errs[i] = err
+		}
+		return vals, errs
+	}
+
+	var ents = make([]entry, len(missing))
+	var setErrs = make([]error, len(missing))
+	for j, i := range missing {
+		x.addKnown(keys[i], dts[j])
+		dt, dur := x.opts.BreakdownStrategy(keys[i], dts[j], e)
+		vals[i] = dt
+		ents[j], setErrs[j] = x.newEntry(keys[i], dt, dur)
+	}
+
+	x.setEntries(ents, setErrs)
+	for j, i := range missing {
+		if !errors.Is(setErrs[j], ErrAdmissionRejected) {
+			errs[i] = setErrs[j]
+		}
+	}
+	return vals, errs
+}
+
+// loadBatch 调用批量数据加载函数, ctx的deadline优先于DataLoadTime
+func (x *xcache) loadBatch(ctx context.Context, keys [][]byte, fn func(context.Context, [][]byte) ([][]byte, error)) ([][]byte, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, x.opts.DataLoadTime)
+		defer cancel()
+	}
+
+	type result struct {
+		dts [][]byte
+		err error
+	}
+
+	x.loaderStats.calls.Inc()
+	var ch = make(chan result, 1)
+	go func() {
+		var ret result
+		var start = time.Now()
+		defer func() {
+			x.loaderStats.observe(time.Since(start))
+			if ret.err != nil && !errors.Is(ret.err, ErrNotExist) {
+				x.loaderStats.errors.Inc()
+			}
+			ch <- ret
+		}()
+		defer xerror.RespErr(&ret.err)
+		ret.dts, ret.err = fn(ctx, keys)
+	}()
+
+	select {
+	case ret := <-ch:
+		if ret.err == nil || ctx.Err() == nil {
+			return ret.dts, xerror.WrapF(ret.err, "keys: %d", len(keys))
+		}
+	case <-ctx.Done():
+	}
+
+	if ctx.Err() == context.DeadlineExceeded {
+		x.loaderStats.timeouts.Inc()
+		return nil, xerror.WrapF(ErrDataLoadTimeout, "keys: %d", len(keys))
+	}
+	return nil, xerror.WrapF(ctx.Err(), "keys: %d", len(keys))
+}
+
+// setEntries 每个分片加一次锁写入多条数据, errs中已经有错误的数据会被跳过
+func (x *xcache) setEntries(ents []entry, errs []error) {
+	var hs = make([]uint32, len(ents))
+	for i := range ents {
+		hs[i] = ents[i].h1
+	}
+
+	for si, group := range x.groupByShard(hs, errs) {
+		if len(group) == 0 {
+			continue
+		}
+
+		var s = x.shards[si]
+		s.mu.Lock()
+		for _, i := range group {
+			errs[i] = x.setItem(s, ents[i])
+		}
+		s.mu.Unlock()
+	}
+}
+
+// hashKeys 校验并计算每个key的hash, 校验失败的错误写入errs
+func (x *xcache) hashKeys(keys [][]byte, errs []error) []uint32 {
+	var hs = make([]uint32, len(keys))
+	for i, k := range keys {
+		if errs[i] = x.checkKey(len(k)); errs[i] == nil {
+			hs[i] = x.hashKey(k)
+		}
+	}
+	return hs
+}
+
+func fillErr(errs []error, err error) []error {
+	for i := range errs {
+		errs[i] = err
+	}
+	return errs
+}
@@ -0,0 +1,94 @@
+package xcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/pubgo/xerror"
+	"testing"
+	"time"
+)
+
+func batchKeys(n int) [][]byte {
+	var keys = make([][]byte, n)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("batch_key_%d", i))
+	}
+	return keys
+}
+
+func TestMSetMGet(t *testing.T) {
+	x := xerror.PanicErr(New()).(*xcache)
+	keys := batchKeys(100)
+
+	for i, err := range x.MSet(keys, keys, time.Second*10) {
+		if err != nil {
+			t.Fatalf("MSet %s: %v", keys[i], err)
+		}
+	}
+
+	vals, errs := x.MGet(append(keys, []byte("batch_missing")))
+	for i := range keys {
+		if errs[i] != nil || string(vals[i]) != string(keys[i]) {
+			t.Fatalf("MGet %s: %s, %v", keys[i], vals[i], errs[i])
+		}
+	}
+	if !errors.Is(errs[len(keys)], ErrKeyNotFound) {
+		t.Fatalf("expected ErrKeyNotFound, got %v", errs[len(keys)])
+	}
+
+	errs = x.MDelete(keys[:50])
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("MDelete %s: %v", keys[i], err)
+		}
+	}
+	if x.Count() != 50 {
+		t.Fatalf("expected 50 items, got %d", x.Count())
+	}
+
+	if errs := x.MSet(keys, keys[:1], time.Second*10); !errors.Is(errs[0], ErrLength) {
+		t.Fatalf("expected ErrLength, got %v", errs[0])
+	}
+}
+
+func TestMGetWithDataLoad(t *testing.T) {
+	x := xerror.PanicErr(New()).(*xcache)
+	keys := batchKeys(10)
+	xerror.Panic(x.Set(keys[0], []byte("cached"), time.Second*10))
+
+	var calls int
+	load := func(ctx context.Context, missing [][]byte) ([][]byte, error) {
+		calls++
+		if len(missing) != len(keys)-1 {
+			t.Fatalf("expected %d missing keys, got %d", len(keys)-1, len(missing))
+		}
+		return missing, nil
+	}
+
+	vals, errs := x.MGetWithDataLoadCtx(context.Background(), keys, time.Second*10, load)
+	for i := range keys {
+		if errs[i] != nil {
+			t.Fatalf("MGetWithDataLoad %s: %v", keys[i], errs[i])
+		}
+	}
+	if string(vals[0]) != "cached" || string(vals[1]) != string(keys[1]) {
+		t.Fatalf("unexpected values %s, %s", vals[0], vals[1])
+	}
+
+	x.MGetWithDataLoadCtx(context.Background(), keys, time.Second*10, load)
+	if calls != 1 {
+		t.Fatalf("expected the loader to be called once, got %d", calls)
+	}
+
+	// 长度不合法的key返回ErrLength, 不影响其他key的加载
+	vals, errs = x.MGetWithDataLoad([][]byte{[]byte("a"), []byte("batch_invalid")}, time.Second*10, func(keys [][]byte) ([][]byte, error) {
+		if len(keys) != 1 {
+			t.Fatalf("expected 1 key, got %q", keys)
+		}
+		return keys, nil
+	})
+	if !errors.Is(errs[0], ErrLength) || errs[1] != nil || string(vals[1]) != "batch_invalid" {
+		t.Fatalf("unexpected %q, %v", vals, errs)
+	}
+}
@@ -0,0 +1,84 @@
+package bloom
+
+import (
+	"math"
+)
+
+// Filter 布隆过滤器, 输入是key的64位hash
+// 不是并发安全的, 需要调用方加锁
+type Filter struct {
+	bits  []uint64
+	mask  uint64
+	k     uint32
+	count uint32
+}
+
+// New 根据预计的数据量n和误判率fp创建布隆过滤器
+func New(n int, fp float64) *Filter {
+	if n < 1 {
+		n = 1
+	}
+
+	if fp <= 0 || fp >= 1 {
+		fp = 0.01
+	}
+
+	// m = -n*ln(p)/ln(2)^2, k = m/n*ln(2)
+	m := uint64(math.Ceil(-float64(n) * math.Log(fp) / (math.Ln2 * math.Ln2)))
+	k := uint32(math.Ceil(float64(m) / float64(n) * math.Ln2))
+
+	// bit数量取2的幂, 方便用mask取余
+	size := uint64(64)
+	for size < m {
+		size <<= 1
+	}
+
+	return &Filter{
+		bits: make([]uint64, size/64),
+		mask: size - 1,
+		k:    k,
+	}
+}
+
+// Add 添加hash, 返回添加之前是否已经存在
+func (f *Filter) Add(h uint64) bool {
+	var existed = true
+	h1, h2 := h, h>>32|h<<32
+	for i := uint32(0); i < f.k; i++ {
+		pos := (h1 + uint64(i)*h2) & f.mask
+		if f.bits[pos>>6]&(1<<(pos&63)) == 0 {
+			existed = false
+			f.bits[pos>>6] |= 1 << (pos & 63)
+		}
+	}
+
+	if !existed {
+		f.count++
+	}
+	return existed
+}
+
+// Has 判断hash是否可能存在, 返回false的时候一定不存在
+func (f *Filter) Has(h uint64) bool {
+	h1, h2 := h, h>>32|h<<32
+	for i := uint32(0); i < f.k; i++ {
+		pos := (h1 + uint64(i)*h2) & f.mask
+		if f.bits[pos>>6]&(1<<(pos&63)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Count 添加的不重复的数据数量
+func (f *Filter) Count() uint32 {
+	return f.count
+}
+
+// Reset 清空过滤器
+func (f *Filter) Reset() {
+	for i := range f.bits {
+		f.bits[i] = 0
+	}
+	f.count = 0
+}
@@ -0,0 +1,71 @@
+package bloom
+
+import (
+	"github.com/cespare/xxhash"
+	"strconv"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	const n = 10000
+	f := New(n, 0.01)
+	for i := 0; i < n; i++ {
+		f.Add(xxhash.Sum64([]byte(strconv.Itoa(i))))
+	}
+
+	for i := 0; i < n; i++ {
+		if !f.Has(xxhash.Sum64([]byte(strconv.Itoa(i)))) {
+			t.Fatalf("false negative: %d", i)
+		}
+	}
+
+	var fp int
+	for i := n; i < 2*n; i++ {
+		if f.Has(xxhash.Sum64([]byte(strconv.Itoa(i)))) {
+			fp++
+		}
+	}
+
+	if rate := float64(fp) / n; rate > 0.02 {
+		t.Fatalf("false positive rate too high: %f", rate)
+	}
+
+	f.Reset()
+	if f.Has(xxhash.Sum64([]byte("0"))) || f.Count() != 0 {
+		t.Fatal("filter should be empty after reset")
+	}
+}
+
+func TestScalable(t *testing.T) {
+	const n = 100000
+	f := NewScalable(1000, 0.01)
+	for i := 0; i < n; i++ {
+		f.Add(xxhash.Sum64([]byte(strconv.Itoa(i))))
+	}
+
+	if len(f.filters) < 2 {
+		t.Fatalf("expected filter to grow, got %d", len(f.filters))
+	}
+
+	for i := 0; i < n; i++ {
+		if !f.Has(xxhash.Sum64([]byte(strconv.Itoa(i)))) {
+			t.Fatalf("false negative: %d", i)
+		}
+	}
+
+	var fp int
+	for i := n; i < 2*n; i++ {
+		if f.Has(xxhash.Sum64([]byte(strconv.Itoa(i)))) {
+			fp++
+		}
+	}
+
+	if rate := float64(fp) / n; rate > 0.02 {
+		t.Fatalf("false positive rate too high: %f", rate)
+	}
+
+	f.Reset()
+	if f.Has(xxhash.Sum64([]byte("0"))) || f.Count() != 0 || len(f.filters) != 1 {
+		t.Fatal("filter should be empty after reset")
+	}
+}
@@ -0,0 +1,82 @@
+package bloom
+
+const (
+	// 每次扩容的时候容量增加的倍数
+	scaleGrowth = 2
+	// 每次扩容的时候误判率收紧的比例, 总的误判率不超过fp/(1-scaleTightening)
+	scaleTightening = 0.8
+)
+
+// Scalable 可扩容的布隆过滤器, 当前的过滤器满了之后添加一个容量更大, 误判率更低的过滤器
+// 不是并发安全的, 需要调用方加锁
+type Scalable struct {
+	filters []*Filter
+	caps    []uint32
+	n       int
+	fp      float64
+}
+
+// NewScalable 根据初始的数据量n和误判率fp创建可扩容的布隆过滤器
+func NewScalable(n int, fp float64) *Scalable {
+	if n < 1 {
+		n = 1
+	}
+
+	if fp <= 0 || fp >= 1 {
+		fp = 0.01
+	}
+
+	var s = &Scalable{n: n, fp: fp * (1 - scaleTightening)}
+	s.grow()
+	return s
+}
+
+func (s *Scalable) grow() {
+	var n, fp = s.n, s.fp
+	for range s.filters {
+		n *= scaleGrowth
+		fp *= scaleTightening
+	}
+	s.filters = append(s.filters, New(n, fp))
+	s.caps = append(s.caps, uint32(n))
+}
+
+// Add 添加hash, 返回添加之前是否已经存在
+func (s *Scalable) Add(h uint64) bool {
+	if s.Has(h) {
+		return true
+	}
+
+	var last = len(s.filters) - 1
+	if s.filters[last].Count() >= s.caps[last] {
+		s.grow()
+		last++
+	}
+	return s.filters[last].Add(h)
+}
+
+// Has 判断hash是否可能存在, 返回false的时候一定不存在
+func (s *Scalable) Has(h uint64) bool {
+	for i := len(s.filters) - 1; i >= 0; i-- {
+		if s.filters[i].Has(h) {
+			return true
+		}
+	}
+	return false
+}
+
+// Count 添加的不重复的数据数量
+func (s *Scalable) Count() uint32 {
+	var count uint32
+	for _, f := range s.filters {
+		count += f.Count()
+	}
+	return count
+}
+
+// Reset 清空过滤器, 只保留第一个过滤器
+func (s *Scalable) Reset() {
+	s.filters[0].Reset()
+	s.filters = s.filters[:1]
+	s.caps = s.caps[:1]
+}
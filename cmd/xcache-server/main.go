@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"github.com/pubgo/xcache"
+	"github.com/pubgo/xcache/consts"
+	"github.com/pubgo/xcache/server"
+	"github.com/pubgo/xerror"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func main() {
+	var addr = flag.String("addr", ":6380", "RESP协议的监听地址")
+	var memcacheAddr = flag.String("memcache-addr", "", "memcached协议的监听地址, 为空的时候不开启")
+	var maxMemory = flag.Uint("maxmemory", consts.DefaultMaxBufSize, "最大缓存")
+	var shards = flag.Int("shards", consts.DefaultShardCount, "分片数量, 必须是2的幂")
+	var lru = flag.Bool("lru", true, "超过最大缓存的时候使用LRU淘汰数据")
+	var aofPath = flag.String("aof", "", "AOF文件路径, 为空的时候不开启AOF")
+	var maxValue = flag.Int("max-value", consts.DefaultMaxDataSize, "key和value的最大总长度, 不能超过1G")
+	var maxKey = flag.Int("max-key", consts.DefaultMaxKeySize, "key的最大长度, 不能超过65535")
+	var minTTL = flag.Duration("min-ttl", consts.MinExpirationLimit, "最小过期时间, 不能小于1ms")
+	var maxTTL = flag.Duration("max-ttl", 0, "最大过期时间, 为0的时候没有上限")
+	flag.Parse()
+
+	var opts = append(server.CacheOptions(*minTTL, *maxTTL),
+		xcache.WithShardCount(*shards),
+		xcache.WithMaxDataSize(*maxValue),
+		xcache.WithMaxKeySize(*maxKey),
+		func(o *xcache.Options) { o.MaxBufSize = uint32(*maxMemory) },
+	)
+	if *lru {
+		opts = append(opts, xcache.WithEvictionPolicy(xcache.NewLRUPolicy))
+	}
+	if *aofPath != "" {
+		opts = append(opts, xcache.WithAOF(*aofPath, xcache.FsyncEverySecond))
+	}
+
+	cache, err := xcache.New(opts...)
+	xerror.Exit(err)
+
+	srv := server.New(cache)
+	go func() {
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+		<-ch
+		_ = srv.Close()
+	}()
+
+	if *memcacheAddr != "" {
+		go func() {
+			log.Printf("xcache-server memcache listening on %s", *memcacheAddr)
+			if err := srv.ListenAndServeMemcache(*memcacheAddr); err != server.ErrServerClosed {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	log.Printf("xcache-server listening on %s", *addr)
+	if err := srv.ListenAndServe(*addr); err != server.ErrServerClosed {
+		log.Fatal(err)
+	}
+	xerror.Exit(cache.Close())
+}
@@ -7,8 +7,10 @@ const (
 	DefaultExpiration = time.Second * 30
 	// 默认最小过期时间2s
 	DefaultMinExpiration = time.Second * 2
-	// 默认最大过期时间1m
+	// 默认最大过期时间1m, 可以通过WithMaxExpiration修改, 没有上限
 	DefaultMaxExpiration = time.Minute
+	// 通过WithMinExpiration可以设置的最小过期时间, 滑动过期按照毫秒保存
+	MinExpirationLimit = time.Millisecond
 
 	// 默认最小缓存10M
 	DefaultMinBufSize = 10 << 20
@@ -18,14 +20,23 @@ const (
 
 	// 缓存数据最小长度, key
 	DefaultMinDataSize = 5
+	// 通过WithMinDataSize可以设置的最小长度
+	MinDataSizeLimit = 1
 	// 缓存数据最大长度
 	DefaultMaxDataSize = 0xffff
 	// Key最大长度
 	DefaultMaxKeySize = 0xff
+	// 通过WithMaxDataSize可以设置的最大长度1G
+	DataSizeLimit = 1 << 30
+	// 通过WithMaxKeySize可以设置的最大长度
+	KeySizeLimit = 0xffff
 
 	// 默认分隔符
 	DefaultDelimiter = "##"
 
+	// 默认不存在的标记的过期时间5s
+	DefaultNegativeTTL = time.Second * 5
+
 	// 默认数据加载超时时间
 	DefaultDataLoadTime = time.Second * 5
 
@@ -34,4 +45,12 @@ const (
 
 	// 默认定期清理缓存数量为总数的10%
 	DefaultClearNum = 0.1
+
+	// 默认分片数量
+	DefaultShardCount = 16
+	// 最大分片数量
+	DefaultMaxShardCount = 1 << 10
+
+	// AOF文件比上一次重写之后增长64M, 自动重写
+	DefaultAOFRewriteSize = 64 << 20
 )
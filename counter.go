@@ -0,0 +1,62 @@
+package xcache
+
+import (
+	"encoding/binary"
+	"github.com/pubgo/xerror"
+	"math"
+	"time"
+)
+
+// IncrBy 原子的把key的值加上delta, 返回新的值, 值按照8字节大端编码的int64保存
+// key不存在或者已经过期的时候从0开始计数, 过期时间为e, key存在的时候保留原来的过期时间和flags
+func (x *xcache) IncrBy(key []byte, delta int64, e time.Duration) (n int64, err error) {
+	defer xerror.RespErr(&err)
+
+	xerror.Panic(x.checkKey(len(key)))
+	xerror.Panic(x.checkExpiration(e))
+
+	h1 := x.hashKey(key)
+	s := x.shard(h1)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	itm, _, existed := x.lookup(s, key, h1)
+	if existed = existed && !itm.negative && time.Now().UnixNano() < itm.expireAt; existed {
+		dt := s.rb.Get(itm.index)[itm.key:]
+		if len(dt) != 8 {
+			return 0, xerror.WrapF(ErrNotCounter, "key: %s, size: %d", key, len(dt))
+		}
+		n = int64(binary.BigEndian.Uint64(dt))
+	}
+
+	if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+		return 0, xerror.WrapF(ErrOverflow, "key: %s, value: %d, delta: %d", key, n, delta)
+	}
+	n += delta
+
+	// RingBuf中的数据不会被原地修改, 写入新的数据替换原来的位置
+	var v [8]byte
+	binary.BigEndian.PutUint64(v[:], uint64(n))
+
+	var ent entry
+	if existed {
+		ent, err = x.newEntryAt(key, v[:], itm.expireAt)
+		xerror.Panic(err)
+		ent.itm.flags, ent.itm.stale = itm.flags, itm.stale
+		ent.itm.mode, ent.itm.idle, ent.itm.maxAt = itm.mode, itm.idle, itm.maxAt
+	} else {
+		ent, err = x.newEntry(key, v[:], e)
+		xerror.Panic(err)
+	}
+
+	xerror.Panic(x.setItem(s, ent))
+	return n, nil
+}
+
+// DecrBy 原子的把key的值减去delta, 和IncrBy一样
+func (x *xcache) DecrBy(key []byte, delta int64, e time.Duration) (int64, error) {
+	if delta == math.MinInt64 {
+		return 0, xerror.WrapF(ErrOverflow, "key: %s, delta: %d", key, delta)
+	}
+	return x.IncrBy(key, -delta, e)
+}
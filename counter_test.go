@@ -0,0 +1,54 @@
+package xcache
+
+import (
+	"errors"
+	"github.com/pubgo/xerror"
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIncrBy(t *testing.T) {
+	x := xerror.PanicErr(New()).(*xcache)
+	key := []byte("hello_counter")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				xerror.PanicErr(x.IncrBy(key, 2, time.Second*10))
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n, err := x.DecrBy(key, 1000, time.Second*10); err != nil || n != 1000 {
+		t.Fatalf("unexpected %d, %v", n, err)
+	}
+
+	// 更新的时候保留原来的过期时间
+	at := time.Now().Add(time.Second * 3)
+	expireAt(x, key, at)
+	xerror.PanicErr(x.IncrBy(key, 1, time.Second*30))
+	if ttl, err := x.TTL(key); err != nil || ttl > time.Second*3 {
+		t.Fatalf("unexpected ttl %s, %v", ttl, err)
+	}
+
+	// 过期之后重新计数
+	expireAt(x, key, time.Now().Add(-time.Millisecond))
+	if n, err := x.IncrBy(key, 5, time.Second*10); err != nil || n != 5 {
+		t.Fatalf("unexpected %d, %v", n, err)
+	}
+
+	if _, err := x.IncrBy(key, math.MaxInt64, time.Second*10); !errors.Is(err, ErrOverflow) {
+		t.Fatalf("expected ErrOverflow, got %v", err)
+	}
+
+	xerror.Panic(x.Set([]byte("hello_string"), []byte("1"), time.Second*10))
+	if _, err := x.IncrBy([]byte("hello_string"), 1, time.Second*10); !errors.Is(err, ErrNotCounter) {
+		t.Fatalf("expected ErrNotCounter, got %v", err)
+	}
+}
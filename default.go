@@ -2,12 +2,14 @@ package xcache
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"github.com/cespare/xxhash"
 	"github.com/pubgo/xcache/consts"
-	"github.com/pubgo/xcache/ringbuf"
 	"github.com/pubgo/xcache/singleflight"
 	"github.com/pubgo/xerror"
 	"go.uber.org/atomic"
+	"math"
 	"math/rand"
 	"sync"
 	"time"
@@ -25,41 +27,118 @@ var defaultXCache = func() *xcache {
 func New(opts ...Option) (*xcache, error) {
 	x := new(xcache)
 	x.sg = new(singleflight.Group)
-	x.rb = ringbuf.NewRingBuf()
-	x.headItem = &headItem{
-		dup:   make(map[string]item),
-		items: make(map[uint32]item),
-	}
 	x = x.init()
 	return x, x.Init(opts...)
 }
 
+// item 读写的时候使用的完整元信息, 分片中只保存itemHead, itemExt只有设置了的时候才保存
 type item struct {
-	_        uint8
-	key      uint8
-	size     uint16
-	index    uint32
+	itemHead
+	itemExt
+}
+
+// itemHead 每个key都保存的元信息, 一共32字节, 没有对齐填充
+type itemHead struct {
+	// 不存在的标记, 数据加载函数返回ErrNotExist的时候写入, 没有数据
+	negative bool
+	// itemExt保存在headItem.ext中
+	extended bool
+	// key的长度, 最大KeySizeLimit
+	key uint16
+	// key和value的总长度, 最大DataSizeLimit
+	size  uint32
+	index uint32
+	// 调用方自定义的标记, 例如memcached的flags
+	flags    uint32
 	expireAt int64
+	// 每次写入都会分配新的cas
+	cas uint64
+}
+
+// itemExt 不常用的元信息, 开启StaleTime, XFetch, 滑动过期或者空闲过期的时候才会保存, 按照RingBuf的index保存
+type itemExt struct {
+	// 过期方式, 通过SetWithOptions设置
+	mode ExpireMode
+	// 过期之后还可以作为旧数据返回的时间, 单位毫秒
+	stale uint32
+	// 数据加载函数的耗时, 单位微秒, 用于XFetch提前刷新
+	delta uint32
+	// 滑动过期和空闲过期命中之后延长的时间, 单位毫秒
+	idle uint32
+	// 空闲过期的最大生存时间, 滑动过期的时候是neverExpire
+	maxAt int64
+}
+
+// neverExpire 永不过期的数据的expireAt
+const neverExpire = math.MaxInt64
+
+// deadline 超过deadline的数据才会被删除, expireAt和deadline之间的数据是过期的旧数据
+func (i item) deadline() int64 {
+	var stale = int64(i.stale) * int64(time.Millisecond)
+	if i.expireAt > neverExpire-stale {
+		return neverExpire
+	}
+	return i.expireAt + stale
+}
+
+// toExpireAt 计算过期时间, NoExpiration和超过int64范围的过期时间返回neverExpire
+func toExpireAt(now time.Time, e time.Duration) int64 {
+	var n = now.UnixNano()
+	if e == NoExpiration || int64(e) > neverExpire-n {
+		return neverExpire
+	}
+	return n + int64(e)
 }
 
 type xcache struct {
-	mu       sync.RWMutex
-	opts     Options
-	size     atomic.Uint32
-	count    atomic.Uint32
-	sg       *singleflight.Group
-	rb       *ringbuf.RingBuf
-	headItem *headItem
-	janitor  *janitor
+	mu        sync.RWMutex
+	opts      Options
+	sg        *singleflight.Group
+	shards    []*shard
+	shardMask uint32
+	janitor   *janitor
+	admission AdmissionPolicy
+	known     *knownKeys
+	aof       *aof
+	cas       atomic.Uint64
+	sweeping  atomic.Bool
+	delimiter []byte
+
+	// namespace的前缀表, 写时复制的map[string]*Namespace, setItem和removeItem读取的时候不需要加锁, nsMu串行化namespace的创建
+	nsMu       sync.Mutex
+	namespaces atomic.Value
+
+	loaderStats loaderStats
 }
 
 func (x *xcache) Count() uint32 {
-	return x.count.Load()
+	var count uint32
+	for _, s := range x.shards {
+		count += s.count.Load()
+	}
+	return count
 }
 
 // GetWithDataLoad ...
 func (x *xcache) GetWithDataLoad(k []byte, e time.Duration, fn ...func(k []byte) (v []byte, err error)) ([]byte, error) {
-	return x.getSet(k, e, fn...)
+	return x.getSet(context.Background(), k, e, withCtx(fn)...)
+}
+
+// GetWithDataLoadCtx ...
+func (x *xcache) GetWithDataLoadCtx(ctx context.Context, k []byte, e time.Duration, fn ...func(ctx context.Context, k []byte) (v []byte, err error)) ([]byte, error) {
+	return x.getSet(ctx, k, e, fn...)
+}
+
+// withCtx 把不带context的数据加载函数转换成带context的数据加载函数
+func withCtx(fn []func(k []byte) ([]byte, error)) []func(context.Context, []byte) ([]byte, error) {
+	if len(fn) == 0 || fn[0] == nil {
+		return nil
+	}
+
+	load := fn[0]
+	return []func(context.Context, []byte) ([]byte, error){func(_ context.Context, k []byte) ([]byte, error) {
+		return load(k)
+	}}
 }
 
 // Options ...
@@ -79,8 +158,19 @@ func (x *xcache) init() *xcache {
 	x.opts.DataLoadTime = consts.DefaultDataLoadTime
 	x.opts.ClearTime = consts.DefaultClearTime
 	x.opts.ClearRate = consts.DefaultClearNum
+	x.opts.ShardCount = consts.DefaultShardCount
+	x.opts.Delimiter = consts.DefaultDelimiter
+	x.delimiter = []byte(consts.DefaultDelimiter)
+	x.namespaces.Store(make(map[string]*Namespace))
+	x.opts.AOFRewriteSize = consts.DefaultAOFRewriteSize
+	x.opts.NegativeTTL = consts.DefaultNegativeTTL
 	x.opts.SnowSlideStrategy = func(expired time.Duration) time.Duration {
-		return expired + time.Duration(rand.Intn(int(x.opts.MinExpiration)))
+		// 加上随机时间会超过int64范围的时候不处理
+		var d = time.Duration(rand.Intn(int(x.opts.MinExpiration)))
+		if expired > math.MaxInt64-d {
+			return expired
+		}
+		return expired + d
 	}
 	x.opts.BreakdownStrategy = func(_ []byte, bytes []byte, dur time.Duration) ([]byte, time.Duration) {
 		if bytes == nil || len(bytes) == 0 {
@@ -88,32 +178,52 @@ func (x *xcache) init() *xcache {
 		}
 		return bytes, dur
 	}
-	x.opts.PenetrateStrategy = func(k []byte, fn ...func(k []byte) ([]byte, error)) ([]byte, error) {
-		var ch = make(chan error, 1)
-		var dt1 interface{}
-		var err error
-		dt1, err = x.sg.Do(string(k), func() (interface{}, error) {
-			go func() {
-				defer xerror.RespChanErr(ch)
-				dt1, err = fn[0](k)
-				ch <- xerror.WrapF(err, "key: %s", k)
-			}()
+	x.opts.PenetrateStrategy = func(ctx context.Context, k []byte, fn ...func(ctx context.Context, k []byte) ([]byte, error)) ([]byte, error) {
+		// 调用方的deadline优先于DataLoadTime
+		if _, ok := ctx.Deadline(); !ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, x.opts.DataLoadTime)
+			defer cancel()
+		}
+
+		for {
+			var leader bool
+			sctx, span := x.startSpan(ctx, SpanJoin, len(k))
+			ch := x.sg.DoChan(string(k), func() (dt interface{}, err error) {
+				defer xerror.RespErr(&err)
+				leader = true
+				return fn[0](sctx, k)
+			})
 
 			select {
-			case <-time.After(x.opts.DataLoadTime):
-				return nil, xerror.WrapF(ErrDataLoadTimeout, "key: %s", k)
-			case err = <-ch:
-				if err != nil {
-					return nil, err
+			case ret := <-ch:
+				span.SetShared(!leader)
+				span.End(ret.Err)
+				if !leader {
+					x.loaderStats.shared.Inc()
+				}
+
+				if ret.Err == nil {
+					return ret.Val.([]byte), nil
 				}
+
+				if ctx.Err() == nil {
+					// 共享的加载被其他调用方的ctx结束了, 重新加载
+					if ret.Shared && (errors.Is(ret.Err, context.Canceled) || errors.Is(ret.Err, context.DeadlineExceeded)) {
+						continue
+					}
+					return nil, &sharedErr{key: k, err: ret.Err}
+				}
+			case <-ctx.Done():
+				span.End(ctx.Err())
 			}
-			return dt1, nil
-		})
-		if err != nil {
-			return nil, err
+			break
 		}
 
-		return dt1.([]byte), nil
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, xerror.WrapF(ErrDataLoadTimeout, "key: %s", k)
+		}
+		return nil, xerror.WrapF(ctx.Err(), "key: %s", k)
 	}
 
 	return x
@@ -136,43 +246,55 @@ func (x *xcache) Init(opts ...Option) error {
 
 	// 过期时间判断
 	{
-		if opt.MaxExpiration > consts.DefaultMaxExpiration || opt.MaxExpiration < consts.DefaultMinExpiration {
-			return xerror.WrapF(ErrExpiration, "MaxExpiration: %s", x.opts.MaxExpiration)
+		// 最大过期时间没有上限
+		if opt.MaxExpiration < consts.MinExpirationLimit {
+			return xerror.WrapF(ErrExpiration, "MaxExpiration: %s", opt.MaxExpiration)
 		}
 
-		if opt.MinExpiration > consts.DefaultMaxExpiration || opt.MinExpiration < consts.DefaultMinExpiration {
+		if opt.MinExpiration < consts.MinExpirationLimit {
 			return xerror.WrapF(ErrExpiration, "MinExpiration: %s", opt.MinExpiration)
 		}
 
-		if opt.MinExpiration > x.opts.MaxExpiration {
+		if opt.MinExpiration > opt.MaxExpiration {
 			return xerror.WrapF(ErrExpiration, "MinExpiration: %s, MaxExpiration: %s", opt.MinExpiration, opt.MaxExpiration)
 		}
 	}
 
 	// 默认过期时间判断
-	if opt.DefaultExpiration > opt.MaxExpiration || opt.DefaultExpiration < consts.DefaultMinExpiration {
+	if opt.DefaultExpiration != NoExpiration && (opt.DefaultExpiration > opt.MaxExpiration || opt.DefaultExpiration < opt.MinExpiration) {
 		return xerror.WrapF(ErrExpiration, "DefaultExpiration: %s", opt.DefaultExpiration)
 	}
 
 	// 数据长度判断
 	{
-		if opt.MaxDataSize > consts.DefaultMaxDataSize || opt.MaxDataSize < consts.DefaultMinDataSize {
-			return xerror.WrapF(ErrLength, "MaxDataSize: %s", opt.MaxDataSize)
+		// 超过DataSizeLimit的时候item.size会溢出
+		if opt.MaxDataSize > consts.DataSizeLimit || opt.MaxDataSize < consts.MinDataSizeLimit {
+			return xerror.WrapF(ErrLength, "MaxDataSize: %d", opt.MaxDataSize)
 		}
 
-		if opt.MinDataSize > consts.DefaultMaxDataSize || opt.MinDataSize < consts.DefaultMinDataSize {
-			return xerror.WrapF(ErrLength, "MaxDataSize: %s", x.opts.MinDataSize)
+		if opt.MinDataSize > consts.DataSizeLimit || opt.MinDataSize < consts.MinDataSizeLimit {
+			return xerror.WrapF(ErrLength, "MinDataSize: %d", opt.MinDataSize)
 		}
 
 		if opt.MinDataSize > opt.MaxDataSize {
-			return xerror.WrapF(ErrLength, "MinDataSize: %s, MaxDataSize: %s", opt.MinDataSize, opt.MaxDataSize)
+			return xerror.WrapF(ErrLength, "MinDataSize: %d, MaxDataSize: %d", opt.MinDataSize, opt.MaxDataSize)
 		}
 
-		if opt.MaxKeySize < consts.DefaultMinDataSize || opt.MaxKeySize > consts.DefaultMaxKeySize || opt.MaxKeySize > opt.MaxDataSize {
-			return xerror.WrapF(ErrLength, "MaxKeySize: %s, MaxDataSizeL %s", opt.MaxKeySize, opt.MaxDataSize)
+		if opt.MaxKeySize < opt.MinDataSize || opt.MaxKeySize > consts.KeySizeLimit || opt.MaxKeySize > opt.MaxDataSize {
+			return xerror.WrapF(ErrLength, "MaxKeySize: %d, MaxDataSize: %d", opt.MaxKeySize, opt.MaxDataSize)
 		}
 	}
 
+	// 不存在的标记的过期时间校验
+	if opt.NegativeTTL > opt.MaxExpiration || opt.NegativeTTL < opt.MinExpiration {
+		return xerror.WrapF(ErrExpiration, "NegativeTTL: %s", opt.NegativeTTL)
+	}
+
+	// 旧数据的时间校验, item中按照毫秒保存
+	if opt.StaleTime < 0 || opt.StaleTime > opt.MaxExpiration || opt.StaleTime/time.Millisecond > math.MaxUint32 {
+		return xerror.WrapF(ErrExpiration, "StaleTime: %s", opt.StaleTime)
+	}
+
 	// 过期清理时间校验
 	if opt.ClearTime < consts.DefaultMinExpiration {
 		return xerror.WrapF(ErrClearTime, "ClearTime: %s", opt.ClearTime)
@@ -183,17 +305,78 @@ func (x *xcache) Init(opts ...Option) error {
 		return xerror.WrapF(ErrDataLoadTime, "DataLoadTime: %s", opt.ClearTime)
 	}
 
+	// XFetch的beta校验
+	if opt.XFetchBeta < 0 {
+		return xerror.WrapF(ErrXFetchBeta, "XFetchBeta: %f", opt.XFetchBeta)
+	}
+
 	// 定期清理数据校验
 	if opt.ClearRate < 0 {
 		return xerror.WrapF(ErrClearNum, "clear_rate: %f", opt.ClearRate)
 	}
 
+	// 分片数量校验, 必须是2的幂
+	if opt.ShardCount < 1 || opt.ShardCount > consts.DefaultMaxShardCount || opt.ShardCount&(opt.ShardCount-1) != 0 {
+		return xerror.WrapF(ErrShardCount, "ShardCount: %d", opt.ShardCount)
+	}
+
+	// 一条数据只能写入一个分片, 不能超过分片的最大缓存
+	if uint32(opt.MaxDataSize) > opt.MaxBufSize/uint32(opt.ShardCount) {
+		return xerror.WrapF(ErrLength, "MaxDataSize: %d, MaxBufSize: %d, ShardCount: %d", opt.MaxDataSize, opt.MaxBufSize, opt.ShardCount)
+	}
+
+	// 缓存中有数据的时候不能修改分片数量
+	if opt.ShardCount != len(x.shards) && x.Count() > 0 {
+		return xerror.WrapF(ErrShardCount, "ShardCount: %d, Count: %d", opt.ShardCount, x.Count())
+	}
+
+	// namespace通过Delimiter区分key, 已经有namespace的时候不能修改
+	if opt.Delimiter == "" || (opt.Delimiter != x.opts.Delimiter && len(x.loadNamespaces()) > 0) {
+		return xerror.WrapF(ErrNamespace, "Delimiter: %q", opt.Delimiter)
+	}
+
+	// 校验都通过之后再修改状态
 	if err := x.initJanitor(); err != nil {
 		return err
 	}
 
+	if opt.ShardCount != len(x.shards) {
+		x.shards = newShards(opt.ShardCount)
+		x.shardMask = uint32(opt.ShardCount - 1)
+	}
+
+	x.initKnownKeys(opt)
 	x.opts = opt
-	return nil
+	x.delimiter = []byte(opt.Delimiter)
+	x.initPolicy()
+	return x.initAOF()
+}
+
+// initPolicy 初始化淘汰策略, 并把已经存在的数据加入到淘汰策略中
+func (x *xcache) initPolicy() {
+	x.admission = nil
+	if x.opts.Admission != nil {
+		x.admission = x.opts.Admission()
+	}
+
+	for _, s := range x.shards {
+		s.mu.Lock()
+		s.policy = nil
+		s.window = nil
+		if x.opts.Eviction != nil && x.admission != nil {
+			s.window = newWindow(uint32(float64(x.shardBufSize()) * windowRatio))
+		}
+		if x.opts.Eviction != nil {
+			s.policy = x.opts.Eviction()
+			for h1, itm := range s.headItem.items {
+				s.policy.Add(itemRef(h1, itm.index))
+			}
+			for k, itm := range s.headItem.dup {
+				s.policy.Add(itemRef(x.hashKey([]byte(k)), itm.index))
+			}
+		}
+		s.mu.Unlock()
+	}
 }
 
 func (x *xcache) checkKey(keySize int) error {
@@ -211,68 +394,534 @@ func (x *xcache) checkData(valSize int) error {
 }
 
 func (x *xcache) checkExpiration(expiration time.Duration) error {
+	if expiration == NoExpiration {
+		return nil
+	}
+
 	if expiration > x.opts.MaxExpiration || expiration < x.opts.MinExpiration {
 		return xerror.WrapF(ErrExpiration, "expiration: %s", expiration)
 	}
 	return nil
 }
 
-func (x *xcache) getSet(k []byte, e time.Duration, fn ...func([]byte) ([]byte, error)) (dt []byte, err error) {
+func (x *xcache) getSet(ctx context.Context, k []byte, e time.Duration, fn ...func(context.Context, []byte) ([]byte, error)) (dt []byte, err error) {
 	defer xerror.RespErr(&err)
 
+	xerror.Panic(ctx.Err())
 	xerror.Panic(x.checkKey(len(k)))
 
 	h1 := x.hashKey(k)
+	s := x.shard(h1)
+	x.record(k)
+
+	var stale bool
+	var canLoad = len(fn) > 0 && fn[0] != nil
+	_, span := x.startSpan(ctx, SpanLookup, len(k))
+	s.mu.RLock()
+	dt, itm, existed, expired := x.getItem(s, k, h1)
+	if expired && canLoad && time.Now().UnixNano() < itm.deadline() {
+		// 返回过期的旧数据, 后台刷新
+		dt, stale = s.rb.Get(itm.index)[itm.key:], true
+		s.stats.staleHits.Inc()
+	}
+	s.mu.RUnlock()
+	span.SetHit(existed || stale)
+	span.End(nil)
+	if !existed && !expired && itm.negative {
+		return nil, xerror.WrapF(ErrKeyNotFound, "key: %s", k)
+	}
+
+	if existed && itm.mode != ExpireAbsolute {
+		x.slide(s, [][]byte{k}, []uint32{h1})
+	}
 
-	x.mu.RLock()
-	itm, _, existed := x.search(string(k), h1)
 	if existed {
-		if time.Now().UnixNano() < itm.expireAt {
-			dt = x.rb.Get(itm.index)[itm.key:]
-			x.mu.RUnlock()
-			return dt, nil
+		if canLoad && x.xfetch(itm) {
+			x.loaderStats.earlyRefreshes.Inc()
+			x.refresh(k, e, fn[0])
 		}
+		return dt, nil
+	}
+
+	if stale {
+		x.refresh(k, e, fn[0])
+		return dt, nil
+	}
+
+	if expired && time.Now().UnixNano() >= itm.deadline() {
 		// 惰性过期清理
-		go func() {
-			_ = x.Delete(k)
-		}()
+		go x.lazyExpire(s, [][]byte{k}, []uint32{h1})
 	}
-	x.mu.RUnlock()
 
 	// key不存在并且数据加载函数为nil
-	if len(fn) == 0 || fn[0] == nil {
+	if !canLoad {
 		return nil, xerror.WrapF(ErrKeyNotFound, "key: %s", k)
 	}
 
+	// 布隆过滤器中一定不存在的key
+	if !x.mayExist(k) {
+		return nil, xerror.WrapF(ErrKeyNotFound, "key: %s", k)
+	}
+
+	load := x.countLoad(fn[0])
+	var start = time.Now()
 	if x.opts.PenetrateStrategy != nil {
-		dt, err = x.opts.PenetrateStrategy(k, fn...)
+		dt, err = x.opts.PenetrateStrategy(ctx, k, load)
 	} else {
-		dt, err = fn[0](k)
+		dt, err = load(ctx, k)
 	}
 
 	if err != nil {
+		if errors.Is(err, ErrNotExist) {
+			// NegativeTTL以内不再调用数据加载函数
+			if err := x.setNegative(k); err != nil && !errors.Is(err, ErrAdmissionRejected) {
+				return nil, err
+			}
+			return nil, xerror.WrapF(ErrKeyNotFound, "key: %s", k)
+		}
+
+		if errors.Is(err, ErrDataLoadTimeout) {
+			x.loaderStats.timeouts.Inc()
+		}
 		return nil, xerror.Wrap(err)
 	}
 
+	x.addKnown(k, dt)
 	dt, e = x.opts.BreakdownStrategy(k, dt, e)
-	return dt, x.Set(k, dt, e)
+	if err = x.setLoaded(ctx, k, dt, e, time.Since(start)); err != nil && !errors.Is(err, ErrAdmissionRejected) {
+		return nil, err
+	}
+	return dt, nil
+}
+
+// setLoaded 写入数据加载函数返回的数据, 同时记录加载的耗时
+func (x *xcache) setLoaded(ctx context.Context, key []byte, v []byte, e time.Duration, delta time.Duration) (err error) {
+	defer xerror.RespErr(&err)
+
+	xerror.Panic(ctx.Err())
+
+	ent, err := x.newEntry(key, v, e)
+	xerror.Panic(err)
+	if delta /= time.Microsecond; delta > math.MaxUint32 {
+		delta = math.MaxUint32
+	}
+	ent.itm.delta = uint32(delta)
+
+	s := x.shard(ent.h1)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return x.setItem(s, ent)
+}
+
+// setNegative 写入不存在的标记, 过期时间是NegativeTTL, 不返回旧数据
+func (x *xcache) setNegative(key []byte) (err error) {
+	defer xerror.RespErr(&err)
+
+	ent, err := x.newEntry(key, nil, x.opts.NegativeTTL)
+	xerror.Panic(err)
+	ent.itm.negative = true
+	ent.itm.stale = 0
+
+	s := x.shard(ent.h1)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return x.setItem(s, ent)
+}
+
+// xfetch XFetch算法, 越接近过期时间, 加载耗时越长, 提前刷新的概率越大
+// now - delta * beta * ln(rand) >= expireAt, rand是(0, 1]之间的随机数
+func (x *xcache) xfetch(itm item) bool {
+	if x.opts.XFetchBeta <= 0 || itm.delta == 0 {
+		return false
+	}
+
+	var delta = float64(itm.delta) * float64(time.Microsecond)
+	var now = float64(time.Now().UnixNano())
+	return now-delta*x.opts.XFetchBeta*math.Log(1-rand.Float64()) >= float64(itm.expireAt)
+}
+
+// refresh 在后台调用数据加载函数刷新旧数据或者提前刷新, 跟PenetrateStrategy共用singleflight, 同一个key只会有一个加载
+// 后台加载不受调用方ctx的影响, 超时时间是DataLoadTime
+func (x *xcache) refresh(k []byte, e time.Duration, fn func(context.Context, []byte) ([]byte, error)) {
+	var key = append([]byte(nil), k...)
+	x.sg.DoChan(string(key), func() (dt interface{}, err error) {
+		defer xerror.RespErr(&err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), x.opts.DataLoadTime)
+		defer cancel()
+
+		var start = time.Now()
+		val, err := x.countLoad(fn)(ctx, key)
+		if errors.Is(err, ErrNotExist) {
+			_ = x.setNegative(key)
+		}
+
+		if err != nil {
+			return nil, xerror.WrapF(err, "key: %s", key)
+		}
+
+		x.addKnown(key, val)
+		val, e = x.opts.BreakdownStrategy(key, val, e)
+		if err = x.setLoaded(ctx, key, val, e, time.Since(start)); err != nil && !errors.Is(err, ErrAdmissionRejected) {
+			return nil, err
+		}
+		return val, nil
+	})
+}
+
+// countLoad 统计数据加载函数的调用次数, 耗时和错误, panic也算作错误
+func (x *xcache) countLoad(fn func(context.Context, []byte) ([]byte, error)) func(context.Context, []byte) ([]byte, error) {
+	return func(ctx context.Context, k []byte) (dt []byte, err error) {
+		x.loaderStats.calls.Inc()
+
+		ctx, span := x.startSpan(ctx, SpanLoad, len(k))
+		var start = time.Now()
+		defer func() {
+			x.loaderStats.observe(time.Since(start))
+			if err != nil && !errors.Is(err, ErrNotExist) {
+				x.loaderStats.errors.Inc()
+			}
+			span.End(err)
+		}()
+		defer xerror.RespErr(&err)
+
+		return fn(ctx, k)
+	}
 }
 
 // GetSet ...
 func (x *xcache) GetSet(k []byte, v []byte, e time.Duration) (bt []byte, err error) {
-	return x.getSet(k, e, func(bytes []byte) ([]byte, error) {
+	return x.GetSetCtx(context.Background(), k, v, e)
+}
+
+// GetSetCtx ...
+func (x *xcache) GetSetCtx(ctx context.Context, k []byte, v []byte, e time.Duration) (bt []byte, err error) {
+	return x.getSet(ctx, k, e, func(_ context.Context, bytes []byte) ([]byte, error) {
 		return v, nil
 	})
 }
 
-func (x *xcache) search(key string, h1 uint32) (item, keyType, bool) {
-	return x.headItem.get(key, h1)
+func (x *xcache) search(s *shard, key string, h1 uint32) (item, keyType, bool) {
+	return s.headItem.get(key, h1)
+}
+
+// lookup 查找key对应的item, 并处理hash冲突, 调用方需要持有s.mu
+// key不存在的时候, 返回的keyType表示新数据应该存放的位置
+func (x *xcache) lookup(s *shard, key []byte, h1 uint32) (item, keyType, bool) {
+	itm, kt, existed := x.search(s, string(key), h1)
+	if existed && (kt == keyDup || bytes.Equal(s.rb.Get(itm.index)[:itm.key], key)) {
+		return itm, kt, true
+	}
+
+	// hash冲突的数据存放到dup中
+	if _, ok := s.headItem.items[h1]; ok {
+		return emptyItem, keyDup, false
+	}
+	return emptyItem, keyIndex, false
+}
+
+// getItem 获取未过期的数据, 过期的时候expired为true, 返回过期的item
+// 不存在的标记existed和expired都为false, itm.negative为true, 调用方需要持有s.mu的读锁
+func (x *xcache) getItem(s *shard, key []byte, h1 uint32) (dt []byte, itm item, existed bool, expired bool) {
+	itm, _, ok := x.lookup(s, key, h1)
+	if !ok {
+		s.stats.misses.Inc()
+		return nil, emptyItem, false, false
+	}
+
+	if time.Now().UnixNano() >= itm.expireAt {
+		s.stats.misses.Inc()
+		return nil, itm, false, true
+	}
+
+	if itm.negative {
+		s.stats.negativeHits.Inc()
+		return nil, itm, false, false
+	}
+
+	s.stats.hits.Inc()
+	x.access(s, itemRef(h1, itm.index))
+	return s.rb.Get(itm.index)[itm.key:], itm, true, false
+}
+
+// setItem 写入数据, 调用方需要持有s.mu
+func (x *xcache) setItem(s *shard, ent entry) error {
+	itm, kt, existed := x.lookup(s, ent.key, ent.h1)
+	k := string(ent.key)
+	ent.itm.cas = x.cas.Inc()
+
+	// namespace的最大缓存, 在修改分片之前检查并预留
+	if ns := x.namespaceOf(ent.key); ns != nil {
+		if err := ns.reserve(k, ent.itm.size); err != nil {
+			return err
+		}
+
+		// 写入失败或者淘汰了当前的key的时候, 按照分片中的数据恢复索引
+		defer func() {
+			if cur, _, ok := x.lookup(s, ent.key, ent.h1); ok {
+				ns.update(k, cur.size)
+			} else {
+				ns.release(k)
+			}
+		}()
+	}
+
+	// 内存超限处理
+	{
+		size := uint32(ent.itm.size)
+		if existed {
+			size -= uint32(itm.size)
+		}
+
+		bufSize := s.size.Load() + size
+		if bufSize > x.shardBufSize() {
+			// 超过最大缓存, 并且没有淘汰策略, 直接报错
+			if s.policy == nil || uint32(ent.itm.size) > x.shardBufSize() {
+				// 同一时间只有一个后台清理过期数据
+				if x.sweeping.CAS(false, true) {
+					go func() {
+						defer x.sweeping.Store(false)
+						_ = x.DeleteExpired()
+					}()
+				}
+				s.stats.bufExceeded.Inc()
+				return xerror.WrapF(ErrBufExceeded, "bufSize: %d", bufSize)
+			}
+
+			// 同步淘汰数据, 直到新数据可以写入, 旧的数据在写入的时候才替换, 淘汰失败的时候保留
+			for {
+				bufSize = s.size.Load() + uint32(ent.itm.size)
+				if existed {
+					bufSize -= uint32(itm.size)
+				}
+				if bufSize <= x.shardBufSize() {
+					break
+				}
+
+				var incoming = uint32(ent.itm.size)
+				if existed {
+					incoming = 0
+				}
+
+				ref, ok := x.victim(s, incoming)
+				if !ok {
+					s.stats.bufExceeded.Inc()
+					return xerror.WrapF(ErrBufExceeded, "bufSize: %d", bufSize)
+				}
+				x.evict(s, ref)
+
+				// 淘汰的可能是当前的key
+				itm, kt, existed = x.lookup(s, ent.key, ent.h1)
+			}
+		}
+	}
+
+	if existed {
+		ent.itm.index = itm.index
+		s.rb.Replace(itm.index, ent.dt)
+		s.headItem.set(k, ent.h1, kt, ent.itm)
+		s.size.Sub(uint32(itm.size))
+		if ref := itemRef(ent.h1, itm.index); s.window == nil || !s.window.resize(ref, uint32(ent.itm.size)) {
+			x.access(s, ref)
+		}
+	} else {
+		ent.itm.index = s.rb.Add(ent.dt)
+		s.headItem.set(k, ent.h1, kt, ent.itm)
+		s.count.Inc()
+		x.add(s, itemRef(ent.h1, ent.itm.index), uint32(ent.itm.size))
+	}
+	s.size.Add(uint32(ent.itm.size))
+	s.stats.sets.Inc()
+	if ent.itm.negative {
+		// 不存在的标记不需要持久化, 只需要删除旧的数据
+		if x.aof != nil {
+			x.aofDel(aofDel, ent.key)
+		}
+		return nil
+	}
+	x.aofSet(ent.key, ent.dt[ent.itm.key:], ent.itm.expireAt, ent.itm.flags)
+	return nil
+}
+
+// evict 淘汰ref对应的数据, 调用方需要持有s.mu
+func (x *xcache) evict(s *shard, ref uint64) {
+	h1, index := parseRef(ref)
+	key, itm, kt, ok := s.headItem.getByIndex(h1, index)
+	if !ok {
+		// 淘汰策略中的数据已经不存在了
+		x.forget(s, ref)
+		return
+	}
+	x.removeItem(s, key, h1, kt, itm)
+	s.stats.evictions.Inc()
+}
+
+// victim 选出需要淘汰的数据, 调用方需要持有s.mu
+// 再写入incoming大小的数据会超过window容量的时候, window中最久没有访问的数据和淘汰策略选出的数据比较访问频率,
+// 频率高的留下, window中的数据留下的时候移到主区域
+func (x *xcache) victim(s *shard, incoming uint32) (uint64, bool) {
+	ref, ok := s.policy.Victim()
+	if s.window == nil {
+		return ref, ok
+	}
+
+	cand, spill := s.window.candidate(incoming)
+	switch {
+	case !spill && ok:
+		return ref, true
+	case !spill:
+		// 主区域已经没有数据
+		return s.window.lru.Victim()
+	case !ok:
+		return cand, true
+	}
+
+	victim, ok := x.refKey(s, ref)
+	if !ok {
+		return ref, true
+	}
+	candKey, ok := x.refKey(s, cand)
+	if !ok {
+		return cand, true
+	}
+
+	if !x.admission.Admit(xxhash.Sum64(candKey), xxhash.Sum64(victim)) {
+		return cand, true
+	}
+	s.window.remove(cand)
+	s.policy.Add(cand)
+	return ref, true
+}
+
+// add 新数据写入淘汰策略, 有window的时候先写入window, window超过容量的数据移到主区域, 调用方需要持有s.mu
+func (x *xcache) add(s *shard, ref uint64, size uint32) {
+	if s.policy == nil {
+		return
+	}
+
+	if s.window == nil {
+		s.policy.Add(ref)
+		return
+	}
+
+	// 缓存没有满的时候window超过容量的数据不需要比较, 直接移到主区域, 至少保留刚写入的数据
+	s.window.add(ref, size)
+	for len(s.window.sizes) > 1 {
+		cand, ok := s.window.candidate(0)
+		if !ok {
+			break
+		}
+		s.window.remove(cand)
+		s.policy.Add(cand)
+	}
+}
+
+// access 数据被访问或者被更新, 可以在读锁下调用
+func (x *xcache) access(s *shard, ref uint64) {
+	if s.policy == nil {
+		return
+	}
+
+	s.policy.Access(ref)
+	if s.window != nil {
+		s.window.lru.Access(ref)
+	}
+}
+
+// forget 数据被删除, 从淘汰策略和window中删除, 调用方需要持有s.mu
+func (x *xcache) forget(s *shard, ref uint64) {
+	if s.policy == nil {
+		return
+	}
+
+	if s.window == nil || !s.window.remove(ref) {
+		s.policy.Remove(ref)
+	}
+}
+
+// refKey 获取ref对应数据的key, 调用方需要持有s.mu
+func (x *xcache) refKey(s *shard, ref uint64) ([]byte, bool) {
+	h1, index := parseRef(ref)
+	_, itm, _, ok := s.headItem.getByIndex(h1, index)
+	if !ok {
+		return nil, false
+	}
+	return s.rb.Get(itm.index)[:itm.key], true
+}
+
+// record 记录key的访问, 给准入策略统计访问频率
+func (x *xcache) record(k []byte) {
+	if x.admission != nil {
+		x.admission.Record(xxhash.Sum64(k))
+	}
+}
+
+// delItem 删除数据, 调用方需要持有s.mu
+func (x *xcache) delItem(s *shard, key []byte, h1 uint32) bool {
+	itm, kt, existed := x.lookup(s, key, h1)
+	if !existed {
+		return false
+	}
+
+	x.removeItem(s, string(key), h1, kt, itm)
+	return true
+}
+
+// removeItem 释放item占用的空间, 调用方需要持有s.mu
+func (x *xcache) removeItem(s *shard, key string, h1 uint32, kt keyType, itm item) {
+	if x.aof != nil {
+		var op = aofDel
+		if time.Now().UnixNano() >= itm.expireAt {
+			op = aofExpire
+		}
+		x.aofDel(op, s.rb.Get(itm.index)[:itm.key])
+	}
+
+	if ns := x.namespaceOf(s.rb.Get(itm.index)[:itm.key]); ns != nil {
+		ns.release(string(s.rb.Get(itm.index)[:itm.key]))
+	}
+
+	s.headItem.del(key, h1, kt)
+	s.rb.Delete(itm.index)
+	s.size.Sub(uint32(itm.size))
+	s.count.Dec()
+	x.forget(s, itemRef(h1, itm.index))
+}
+
+// lazyExpire 惰性删除已经过期的数据, 防止误删已经重新写入的数据
+func (x *xcache) lazyExpire(s *shard, keys [][]byte, hs []uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var now = time.Now().UnixNano()
+	for i, key := range keys {
+		itm, kt, existed := x.lookup(s, key, hs[i])
+		if existed && now >= itm.deadline() {
+			x.removeItem(s, string(key), hs[i], kt, itm)
+			s.stats.lazyExpirations.Inc()
+		}
+	}
+}
+
+// FreeSlots 所有分片RingBuf空闲队列中可以复用的位置数量
+func (x *xcache) FreeSlots() uint32 {
+	var n uint32
+	for _, s := range x.shards {
+		s.mu.RLock()
+		n += uint32(s.rb.FreeSlots())
+		s.mu.RUnlock()
+	}
+	return n
 }
 
 // Size ...
 func (x *xcache) Size() uint32 {
-	//return x.size.Load() + x.count.Load()*20
-	return x.size.Load()
+	var size uint32
+	for _, s := range x.shards {
+		//size += s.size.Load() + s.count.Load()*20
+		size += s.size.Load()
+	}
+	return size
 }
 
 // SetDefault ...
@@ -282,65 +931,67 @@ func (x *xcache) SetDefault(key []byte, v []byte) error {
 
 // Set ...
 func (x *xcache) Set(key []byte, v []byte, e time.Duration) (err error) {
+	return x.SetCtx(context.Background(), key, v, e)
+}
+
+// SetCtx ...
+func (x *xcache) SetCtx(ctx context.Context, key []byte, v []byte, e time.Duration) (err error) {
 	defer xerror.RespErr(&err)
 
-	keyLen := len(key)
-	xerror.Panic(x.checkKey(keyLen))
+	xerror.Panic(ctx.Err())
 
-	l := keyLen + len(v)
-	xerror.Panic(x.checkData(l))
+	ent, err := x.newEntry(key, v, e)
+	xerror.Panic(err)
+
+	s := x.shard(ent.h1)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return x.setItem(s, ent)
+}
+
+// entry 待写入缓存的数据
+type entry struct {
+	key []byte
+	h1  uint32
+	dt  []byte
+	itm item
+}
+
+// newEntry 校验并构造待写入的数据, 不需要持有锁
+func (x *xcache) newEntry(key []byte, v []byte, e time.Duration) (ent entry, err error) {
+	defer xerror.RespErr(&err)
 
 	xerror.Panic(x.checkExpiration(e))
-	// 给时间设置随机性，防止雪崩
-	if x.opts.SnowSlideStrategy != nil {
+	// 给时间设置随机性，防止雪崩, 永不过期的数据不需要
+	if x.opts.SnowSlideStrategy != nil && e != NoExpiration {
 		e = x.opts.SnowSlideStrategy(e)
 	}
 
-	var dt = make([]byte, l)
-	copy(dt[copy(dt, key):], v)
-	//dt=append(dt,key...)
-	//dt=append(dt,v...)
-
-	// 内存超限处理
-	{
-		// 超过最大缓存, 直接报错
-		bufSize := x.size.Add(uint32(l))
-		if bufSize > x.opts.MaxBufSize {
-			x.size.Sub(uint32(l))
-			go func() {
-				_ = x.DeleteExpired()
-			}()
-			return xerror.WrapF(ErrBufExceeded, "bufSize: %d", bufSize)
-		}
-	}
+	return x.newEntryAt(key, v, toExpireAt(time.Now(), e))
+}
 
-	var itm1 item
-	itm1.key = uint8(keyLen)
-	itm1.size = uint16(l)
-	itm1.expireAt = time.Now().Add(e).UnixNano()
+// newEntryAt 使用绝对的过期时间构造待写入的数据, 不校验过期时间
+func (x *xcache) newEntryAt(key []byte, v []byte, expireAt int64) (ent entry, err error) {
+	defer xerror.RespErr(&err)
 
-	h1 := x.hashKey(key)
-	k := string(key)
+	keyLen := len(key)
+	xerror.Panic(x.checkKey(keyLen))
 
-	x.mu.Lock()
-	defer x.mu.Unlock()
-	itm, kt, existed := x.search(k, h1)
-	if existed {
-		itm1.index = itm.index
-		if kt == keyIndex && bytes.Equal(x.rb.Get(itm.index)[:itm.key], key) {
-			x.headItem.set(k, h1, keyIndex, itm1)
-		} else {
-			x.headItem.set(k, h1, keyDup, itm1)
-		}
+	l := keyLen + len(v)
+	xerror.Panic(x.checkData(l))
 
-		x.rb.Replace(itm.index, dt)
-		x.size.Sub(uint32(l))
-	} else {
-		itm1.index = x.rb.Add(dt)
-		x.headItem.set(k, h1, keyIndex, itm1)
-		x.count.Inc()
-	}
+	var dt = make([]byte, l)
+	copy(dt[copy(dt, key):], v)
+	//dt=append(dt,key...)
+	//dt=append(dt,v...)
 
+	ent.key = key
+	ent.h1 = x.hashKey(key)
+	ent.dt = dt
+	ent.itm.key = uint16(keyLen)
+	ent.itm.size = uint32(l)
+	ent.itm.expireAt = expireAt
+	ent.itm.stale = uint32(x.opts.StaleTime / time.Millisecond)
 	return
 }
 
@@ -350,61 +1001,162 @@ func (x *xcache) hashKey(k []byte) uint32 {
 
 // Get ...
 func (x *xcache) Get(k []byte) ([]byte, error) {
-	return x.getSet(k, x.opts.DefaultExpiration)
+	return x.GetCtx(context.Background(), k)
+}
+
+// GetCtx ...
+func (x *xcache) GetCtx(ctx context.Context, k []byte) ([]byte, error) {
+	return x.getSet(ctx, k, x.opts.DefaultExpiration)
 }
 
 // Delete ...
 func (x *xcache) Delete(key []byte) (err error) {
-	xerror.RespErr(&err)
+	return x.DeleteCtx(context.Background(), key)
+}
+
+// DeleteCtx ...
+func (x *xcache) DeleteCtx(ctx context.Context, key []byte) (err error) {
+	defer xerror.RespErr(&err)
 
+	xerror.Panic(ctx.Err())
 	xerror.Panic(x.checkKey(len(key)))
 
 	h1 := x.hashKey(key)
-	k := string(key)
 
-	x.mu.Lock()
-	itm, kt, existed := x.search(k, h1)
-	if !existed {
-		x.mu.Unlock()
+	s := x.shard(h1)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !x.delItem(s, key, h1) {
 		return xerror.WrapF(ErrKeyNotFound, "key: %s", key)
 	}
-	x.headItem.del(k, h1, kt)
-	x.mu.Unlock()
-
-	x.rb.Delete(itm.index)
-	x.size.Sub(uint32(itm.size))
-	x.count.Dec()
+	s.stats.deletes.Inc()
 	return nil
 }
 
+// TTL 获取key剩余的过期时间, 永不过期的key返回NoExpiration, 不存在的key返回KeyNotExist和ErrKeyNotFound
+func (x *xcache) TTL(key []byte) (ttl time.Duration, err error) {
+	defer xerror.RespErr(&err)
+	defer func() {
+		if err != nil {
+			ttl = KeyNotExist
+		}
+	}()
+
+	xerror.Panic(x.checkKey(len(key)))
+
+	h1 := x.hashKey(key)
+	s := x.shard(h1)
+	s.mu.RLock()
+	itm, _, existed := x.lookup(s, key, h1)
+	s.mu.RUnlock()
+
+	if !existed || itm.negative {
+		return 0, xerror.WrapF(ErrKeyNotFound, "key: %s", key)
+	}
+
+	if itm.expireAt == neverExpire {
+		return NoExpiration, nil
+	}
+
+	if ttl = time.Duration(itm.expireAt - time.Now().UnixNano()); ttl <= 0 {
+		return 0, xerror.WrapF(ErrKeyNotFound, "key: %s", key)
+	}
+	return ttl, nil
+}
+
+// Persist 去掉key的过期时间, 永不过期
+func (x *xcache) Persist(key []byte) error {
+	return x.Expire(key, NoExpiration)
+}
+
+// Expire 修改key的过期时间, 和Touch一样
+func (x *xcache) Expire(key []byte, e time.Duration) error {
+	return x.Touch(key, e)
+}
+
+// Touch 原地修改key的过期时间, 不重写数据, 不会经过SnowSlideStrategy, e为NoExpiration的时候永不过期
+// 滑动过期和空闲过期的数据Touch之后按照绝对时间过期
+func (x *xcache) Touch(key []byte, e time.Duration) error {
+	_, err := x.touch(key, e, false)
+	return err
+}
+
+// GetAndTouch 获取数据的同时修改过期时间, 用于滑动过期, 计入命中和未命中的统计
+func (x *xcache) GetAndTouch(key []byte, e time.Duration) ([]byte, error) {
+	return x.touch(key, e, true)
+}
+
+func (x *xcache) touch(key []byte, e time.Duration, get bool) (dt []byte, err error) {
+	defer xerror.RespErr(&err)
+
+	xerror.Panic(x.checkKey(len(key)))
+	xerror.Panic(x.checkExpiration(e))
+
+	h1 := x.hashKey(key)
+	s := x.shard(h1)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var now = time.Now()
+	itm, kt, existed := x.lookup(s, key, h1)
+	if !existed || itm.negative || now.UnixNano() >= itm.expireAt {
+		if get && itm.negative {
+			s.stats.negativeHits.Inc()
+		} else if get {
+			s.stats.misses.Inc()
+		}
+		return nil, xerror.WrapF(ErrKeyNotFound, "key: %s", key)
+	}
+
+	if get {
+		s.stats.hits.Inc()
+	}
+
+	// 修改过期时间之后按照绝对时间过期
+	itm.mode, itm.idle, itm.maxAt = ExpireAbsolute, 0, 0
+	itm.expireAt = toExpireAt(now, e)
+	s.headItem.set(string(key), h1, kt, itm)
+
+	dt = s.rb.Get(itm.index)[itm.key:]
+	x.aofSet(key, dt, itm.expireAt, itm.flags)
+	return dt, nil
+}
+
 // 随机的找寻
 func (x *xcache) randomDeleteExpired() {
 	x.sg.Clear()
 
-	x.mu.Lock()
-	defer x.mu.Unlock()
-
-	for _, itm := range x.headItem.randomExpired(x.opts.ClearRate) {
-		x.headItem.del("", itm.h1, keyIndex)
-		x.rb.Delete(itm.index)
-		x.size.Sub(uint32(itm.size))
-		x.count.Dec()
+	for _, s := range x.shards {
+		s.mu.Lock()
+		for _, itm := range s.headItem.randomExpired(x.opts.ClearRate) {
+			x.removeItem(s, "", itm.h1, keyIndex, itm.item)
+			s.stats.janitorExpirations.Inc()
+		}
+		s.mu.Unlock()
 	}
 }
 
 // DeleteExpired ...
 func (x *xcache) DeleteExpired() error {
+	return x.DeleteExpiredCtx(context.Background())
+}
+
+// DeleteExpiredCtx ...
+func (x *xcache) DeleteExpiredCtx(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	_, err := x.sg.Do("DeleteExpired", func() (interface{}, error) {
-		x.mu.Lock()
-		defer x.mu.Unlock()
-
-		x.headItem.dupClear()
-		x.rb.ClearExpired()
-		for _, itm := range x.headItem.randomExpired(1.0) {
-			x.headItem.del("", itm.h1, keyIndex)
-			x.rb.Delete(itm.index)
-			x.size.Sub(uint32(itm.size))
-			x.count.Dec()
+		for _, s := range x.shards {
+			s.mu.Lock()
+			s.headItem.dupClear()
+			s.rb.ClearExpired()
+			for _, itm := range s.headItem.randomExpired(1.0) {
+				x.removeItem(s, "", itm.h1, keyIndex, itm.item)
+				s.stats.janitorExpirations.Inc()
+			}
+			s.mu.Unlock()
 		}
 		return nil, nil
 	})
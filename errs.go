@@ -1,6 +1,7 @@
 package xcache
 
 import (
+	"fmt"
 	"github.com/pubgo/xerror"
 )
 
@@ -24,4 +25,64 @@ var (
 	ErrDataLoadTime = ErrXCache.New("数据加载函数时间设置错误")
 	// ErrDataLoadTimeout...
 	ErrDataLoadTimeout = ErrXCache.New("数据加载超时")
+	// ErrXFetchBeta ...
+	ErrXFetchBeta = ErrXCache.New("XFetch的beta不能小于0")
+	// ErrShardCount ...
+	ErrShardCount = ErrXCache.New("分片数量必须是2的幂, 并且缓存不为空的时候不能修改")
+	// ErrSnapshot ...
+	ErrSnapshot = ErrXCache.New("快照格式错误或者已经损坏")
+	// ErrAOF ...
+	ErrAOF = ErrXCache.New("AOF文件错误")
+	// ErrCASMismatch ...
+	ErrCASMismatch = ErrXCache.New("数据已经被修改, cas不匹配")
+	// ErrBloomFilter ...
+	ErrBloomFilter = ErrXCache.New("没有开启布隆过滤器")
+	// ErrNotExist 数据加载函数返回ErrNotExist表示数据不存在, 缓存会在NegativeTTL以内记住key不存在
+	ErrNotExist = ErrXCache.New("数据不存在")
+	// ErrAdmissionRejected ...
+	ErrAdmissionRejected = ErrXCache.New("准入策略拒绝写入")
+	// ErrVersionMismatch CompareAndSwap返回的错误同时也是ErrCASMismatch
+	ErrVersionMismatch = ErrXCache.New("数据已经被修改, 版本号不匹配")
+	// ErrKeyExists ...
+	ErrKeyExists = ErrXCache.New("key已经存在")
+	// ErrNamespace ...
+	ErrNamespace = ErrXCache.New("namespace不存在, 名字为空或者包含Delimiter")
+	// ErrNamespaceQuota ...
+	ErrNamespaceQuota = ErrXCache.New("超过了namespace的最大缓存")
+	// ErrNotCounter ...
+	ErrNotCounter = ErrXCache.New("数据不是8字节的整数")
+	// ErrOverflow ...
+	ErrOverflow = ErrXCache.New("计数超过了int64的范围")
 )
+
+// sharedErr singleflight共享的数据加载错误, xerror.Wrap会清空被包装的*xerror,
+// 所以每个调用方单独包装一层, 共享的错误不会被修改
+type sharedErr struct {
+	key []byte
+	err error
+}
+
+func (e *sharedErr) Error() string {
+	return fmt.Sprintf("key: %s, %v", e.key, e.err)
+}
+
+func (e *sharedErr) Unwrap() error {
+	return e.err
+}
+
+// versionErr CompareAndSwap的版本号不匹配, errors.Is对ErrVersionMismatch和ErrCASMismatch都成立
+type versionErr struct {
+	err error
+}
+
+func (e *versionErr) Error() string {
+	return e.err.Error()
+}
+
+func (e *versionErr) Unwrap() error {
+	return e.err
+}
+
+func (e *versionErr) Is(target error) bool {
+	return target == ErrVersionMismatch
+}
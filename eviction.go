@@ -0,0 +1,259 @@
+package xcache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// EvictionPolicy 淘汰策略, 缓存超过MaxBufSize的时候, Set会同步淘汰Victim返回的数据, 直到新数据可以写入
+// ref是item的唯一标识, 由key的hash和item在RingBuf中的index组成
+// 实现需要保证并发安全, Access会在读锁下被并发调用
+type EvictionPolicy interface {
+	// Add 新写入数据
+	Add(ref uint64)
+	// Access 数据被访问或者被更新
+	Access(ref uint64)
+	// Remove 数据被删除, 过期或者淘汰
+	Remove(ref uint64)
+	// Victim 返回下一个应该被淘汰的数据, 没有数据返回false
+	Victim() (ref uint64, ok bool)
+}
+
+// AdmissionPolicy 准入策略, 和淘汰策略一起组成W-TinyLFU, 新数据先写入window LRU,
+// window满了之后, window中最久没有访问的数据candidate和淘汰策略选出的数据victim比较, Admit返回true的时候淘汰victim,
+// candidate进入淘汰策略管理的主区域, 否则淘汰candidate
+// h是key的64位xxhash, 实现需要保证并发安全, 可以参考tinylfu.New
+type AdmissionPolicy interface {
+	// Record 记录一次访问, 命中和未命中都会调用
+	Record(h uint64)
+	// Admit 返回true的时候candidate替换victim
+	Admit(candidate, victim uint64) bool
+}
+
+// windowRatio window占分片缓存的比例
+const windowRatio = 0.01
+
+// window W-TinyLFU的window LRU, 设置了准入策略的时候每个分片都有一个window, window中的数据不在淘汰策略中
+// Access在读锁下调用, 其他方法调用方需要持有s.mu
+type window struct {
+	lru   EvictionPolicy
+	sizes map[uint64]uint32
+	size  uint32
+	cap   uint32
+}
+
+func newWindow(cap uint32) *window {
+	return &window{lru: NewLRUPolicy(), sizes: make(map[uint64]uint32), cap: cap}
+}
+
+func (w *window) add(ref uint64, size uint32) {
+	w.lru.Add(ref)
+	w.size = w.size - w.sizes[ref] + size
+	w.sizes[ref] = size
+}
+
+// resize 更新window中数据的大小, 数据不在window中返回false
+func (w *window) resize(ref uint64, size uint32) bool {
+	old, ok := w.sizes[ref]
+	if !ok {
+		return false
+	}
+
+	w.lru.Access(ref)
+	w.size = w.size - old + size
+	w.sizes[ref] = size
+	return true
+}
+
+func (w *window) remove(ref uint64) bool {
+	size, ok := w.sizes[ref]
+	if !ok {
+		return false
+	}
+
+	w.lru.Remove(ref)
+	delete(w.sizes, ref)
+	w.size -= size
+	return true
+}
+
+// candidate 再写入size大小的数据会超过window容量的时候, 返回window中最久没有访问的数据
+func (w *window) candidate(size uint32) (uint64, bool) {
+	if w.size+size <= w.cap {
+		return 0, false
+	}
+	return w.lru.Victim()
+}
+
+func itemRef(h1 uint32, index uint32) uint64 {
+	return uint64(h1)<<32 | uint64(index)
+}
+
+func parseRef(ref uint64) (h1 uint32, index uint32) {
+	return uint32(ref >> 32), uint32(ref)
+}
+
+// NewLRUPolicy 淘汰最近最少使用的数据
+func NewLRUPolicy() EvictionPolicy {
+	return &listPolicy{items: make(map[uint64]*list.Element), moveOnAccess: true}
+}
+
+// NewFIFOPolicy 淘汰最早写入的数据
+func NewFIFOPolicy() EvictionPolicy {
+	return &listPolicy{items: make(map[uint64]*list.Element)}
+}
+
+// NewLFUPolicy 淘汰访问次数最少的数据, 次数相同的时候淘汰最久没有访问的数据
+func NewLFUPolicy() EvictionPolicy {
+	return &lfuPolicy{items: make(map[uint64]*list.Element), freqs: make(map[uint32]*list.List)}
+}
+
+// listPolicy LRU和FIFO的实现, 链表头部是最新的数据
+type listPolicy struct {
+	mu           sync.Mutex
+	ll           list.List
+	items        map[uint64]*list.Element
+	moveOnAccess bool
+}
+
+func (p *listPolicy) Add(ref uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if e, ok := p.items[ref]; ok {
+		p.ll.MoveToFront(e)
+		return
+	}
+	p.items[ref] = p.ll.PushFront(ref)
+}
+
+func (p *listPolicy) Access(ref uint64) {
+	if !p.moveOnAccess {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if e, ok := p.items[ref]; ok {
+		p.ll.MoveToFront(e)
+	}
+}
+
+func (p *listPolicy) Remove(ref uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if e, ok := p.items[ref]; ok {
+		p.ll.Remove(e)
+		delete(p.items, ref)
+	}
+}
+
+func (p *listPolicy) Victim() (uint64, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	e := p.ll.Back()
+	if e == nil {
+		return 0, false
+	}
+	return e.Value.(uint64), true
+}
+
+type lfuEntry struct {
+	ref  uint64
+	freq uint32
+}
+
+// lfuPolicy O(1)的LFU实现, 每个访问次数对应一个链表
+type lfuPolicy struct {
+	mu      sync.Mutex
+	items   map[uint64]*list.Element
+	freqs   map[uint32]*list.List
+	minFreq uint32
+}
+
+func (p *lfuPolicy) push(ent *lfuEntry) {
+	l, ok := p.freqs[ent.freq]
+	if !ok {
+		l = list.New()
+		p.freqs[ent.freq] = l
+	}
+	p.items[ent.ref] = l.PushFront(ent)
+}
+
+func (p *lfuPolicy) unlink(e *list.Element) *lfuEntry {
+	ent := e.Value.(*lfuEntry)
+	l := p.freqs[ent.freq]
+	l.Remove(e)
+	if l.Len() == 0 {
+		delete(p.freqs, ent.freq)
+	}
+	delete(p.items, ent.ref)
+	return ent
+}
+
+func (p *lfuPolicy) Add(ref uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.items[ref]; ok {
+		p.access(ref)
+		return
+	}
+	p.push(&lfuEntry{ref: ref, freq: 1})
+	p.minFreq = 1
+}
+
+func (p *lfuPolicy) Access(ref uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.access(ref)
+}
+
+func (p *lfuPolicy) access(ref uint64) {
+	e, ok := p.items[ref]
+	if !ok {
+		return
+	}
+
+	ent := p.unlink(e)
+	if _, ok := p.freqs[ent.freq]; !ok && p.minFreq == ent.freq {
+		p.minFreq++
+	}
+	ent.freq++
+	p.push(ent)
+}
+
+func (p *lfuPolicy) Remove(ref uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if e, ok := p.items[ref]; ok {
+		p.unlink(e)
+	}
+}
+
+func (p *lfuPolicy) Victim() (uint64, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.items) == 0 {
+		return 0, false
+	}
+
+	// 删除数据之后minFreq可能已经失效, 重新查找最小的访问次数
+	if _, ok := p.freqs[p.minFreq]; !ok {
+		var first = true
+		for freq := range p.freqs {
+			if first || freq < p.minFreq {
+				p.minFreq = freq
+				first = false
+			}
+		}
+	}
+
+	return p.freqs[p.minFreq].Back().Value.(*lfuEntry).ref, true
+}
@@ -0,0 +1,171 @@
+package xcache
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/pubgo/xerror"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEvictionPolicy(t *testing.T) {
+	victim := func(p EvictionPolicy) uint64 {
+		ref, ok := p.Victim()
+		if !ok {
+			t.Fatal("expected a victim")
+		}
+		return ref
+	}
+
+	lru := NewLRUPolicy()
+	lru.Add(1)
+	lru.Add(2)
+	lru.Add(3)
+	lru.Access(1)
+	if ref := victim(lru); ref != 2 {
+		t.Fatalf("lru: expected 2, got %d", ref)
+	}
+
+	fifo := NewFIFOPolicy()
+	fifo.Add(1)
+	fifo.Add(2)
+	fifo.Access(1)
+	if ref := victim(fifo); ref != 1 {
+		t.Fatalf("fifo: expected 1, got %d", ref)
+	}
+
+	lfu := NewLFUPolicy()
+	lfu.Add(1)
+	lfu.Add(2)
+	lfu.Add(3)
+	lfu.Access(1)
+	lfu.Access(1)
+	lfu.Access(3)
+	if ref := victim(lfu); ref != 2 {
+		t.Fatalf("lfu: expected 2, got %d", ref)
+	}
+	lfu.Remove(2)
+	if ref := victim(lfu); ref != 3 {
+		t.Fatalf("lfu: expected 3, got %d", ref)
+	}
+	lfu.Remove(3)
+	lfu.Remove(1)
+	if _, ok := lfu.Victim(); ok {
+		t.Fatal("lfu: expected no victim")
+	}
+}
+
+func TestSetWithEviction(t *testing.T) {
+	const bufSize = 10 << 20
+	x := xerror.PanicErr(New(WithEvictionPolicy(NewLRUPolicy))).(*xcache)
+	xerror.Panic(x.Init(func(o *Options) { o.MaxBufSize = bufSize }))
+
+	hot := []byte("eviction_hot")
+	val := bytes.Repeat([]byte("v"), 60<<10)
+	xerror.Panic(x.Set(hot, val, time.Second*10))
+
+	for i := 0; i < 2*bufSize/len(val); i++ {
+		key := []byte(fmt.Sprintf("eviction_%d", i))
+		if err := x.Set(key, val, time.Second*10); err != nil {
+			t.Fatalf("set %s: %v", key, err)
+		}
+
+		if _, err := x.Get(hot); err != nil {
+			t.Fatalf("hot key evicted after %d sets: %v", i, err)
+		}
+	}
+
+	if x.Size() > bufSize {
+		t.Fatalf("size %d exceeds MaxBufSize", x.Size())
+	}
+
+	if _, err := x.Get([]byte("eviction_0")); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("expected eviction_0 to be evicted, got %v", err)
+	}
+}
+
+// noVictimPolicy 不返回任何可以淘汰的数据
+type noVictimPolicy struct{ EvictionPolicy }
+
+func (noVictimPolicy) Victim() (uint64, bool) { return 0, false }
+
+func TestSetWithEvictionFailed(t *testing.T) {
+	const bufSize = 10 << 20
+	x := xerror.PanicErr(New(WithEvictionPolicy(func() EvictionPolicy {
+		return noVictimPolicy{NewLRUPolicy()}
+	}))).(*xcache)
+	xerror.Panic(x.Init(func(o *Options) { o.MaxBufSize, o.ShardCount = bufSize, 1 }))
+
+	key := []byte("eviction_key")
+	old := bytes.Repeat([]byte("o"), 30<<10)
+	xerror.Panic(x.Set(key, old, time.Second*10))
+
+	// 没有可以淘汰的数据, 更新失败的时候旧的数据还在
+	for i := 0; ; i++ {
+		if err := x.Set([]byte(fmt.Sprintf("eviction_%d", i)), old, time.Second*10); err != nil {
+			break
+		}
+	}
+	if err := x.Set(key, bytes.Repeat([]byte("n"), 60<<10), time.Second*10); !errors.Is(err, ErrBufExceeded) {
+		t.Fatalf("expected ErrBufExceeded, got %v", err)
+	}
+
+	v, err := x.Get(key)
+	if err != nil || !bytes.Equal(v, old) {
+		t.Fatalf("expected the old value to be kept, got %v", err)
+	}
+}
+
+// countAdmission 按照Record的次数比较访问频率
+type countAdmission struct {
+	mu     sync.Mutex
+	counts map[uint64]int
+}
+
+func (a *countAdmission) Record(h uint64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.counts[h]++
+}
+
+func (a *countAdmission) Admit(candidate, victim uint64) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.counts[candidate] > a.counts[victim]
+}
+
+func TestSetWithWindow(t *testing.T) {
+	const bufSize = 10 << 20
+	x := xerror.PanicErr(New(
+		WithEvictionPolicy(NewLRUPolicy),
+		WithAdmissionPolicy(func() AdmissionPolicy { return &countAdmission{counts: make(map[uint64]int)} }),
+	)).(*xcache)
+	xerror.Panic(x.Init(func(o *Options) { o.MaxBufSize, o.ShardCount = bufSize, 1 }))
+
+	hot := []byte("window_hot")
+	val := bytes.Repeat([]byte("v"), 30<<10)
+	xerror.Panic(x.Set(hot, val, time.Second*10))
+	for i := 0; i < 10; i++ {
+		xerror.PanicErr(x.Get(hot))
+	}
+
+	// 只写入一次的扫描数据在window中被淘汰, 不会替换主区域中访问频率高的数据
+	for i := 0; i < 2*bufSize/len(val); i++ {
+		xerror.Panic(x.Set([]byte(fmt.Sprintf("window_%d", i)), val, time.Second*10))
+	}
+	if _, err := x.Get(hot); err != nil {
+		t.Fatalf("hot key evicted by a scan: %v", err)
+	}
+
+	// 新数据总是先写入window, 最近写入的数据还在
+	if _, err := x.Get([]byte(fmt.Sprintf("window_%d", 2*bufSize/len(val)-1))); err != nil {
+		t.Fatalf("expected the latest key in the window, got %v", err)
+	}
+
+	s := x.shards[0]
+	if s.window.size > s.window.cap || x.Size() > bufSize {
+		t.Fatalf("window %d/%d, size %d", s.window.size, s.window.cap, x.Size())
+	}
+}
@@ -0,0 +1,130 @@
+package xcache
+
+import (
+	"github.com/pubgo/xerror"
+	"math"
+	"time"
+)
+
+// ExpireMode 数据的过期方式
+type ExpireMode uint8
+
+const (
+	// ExpireAbsolute 写入的时候确定过期时间, 默认的过期方式
+	ExpireAbsolute ExpireMode = iota
+	// ExpireSliding 每次命中都把过期时间重新设置为TTL之后
+	ExpireSliding
+	// ExpireIdle TTL以内没有访问就过期, 最多存活MaxLifetime
+	ExpireIdle
+)
+
+// SetOptions SetWithOptions的参数
+type SetOptions struct {
+	// 过期时间, ExpireSliding和ExpireIdle的时候是每次命中之后延长的时间
+	TTL  time.Duration
+	Mode ExpireMode
+	// ExpireIdle的最大生存时间, 从写入开始计算, 为NoExpiration的时候和ExpireSliding一样
+	MaxLifetime time.Duration
+	// 为true的时候TTL不经过SnowSlideStrategy, 用于调用方指定的精确过期时间, 例如redis的EX和PX
+	Exact bool
+	// 为true的时候保留key原来的过期时间和过期方式, 忽略TTL, Mode和MaxLifetime, key不存在的时候返回ErrKeyNotFound
+	KeepTTL bool
+	// 为true的时候只有key不存在或者已经过期才写入, 否则返回ErrKeyExists
+	NX bool
+}
+
+// SetWithOptions 写入数据并且指定过期方式, 滑动过期和空闲过期的数据在Get, MGet和GetWithMeta命中之后延长过期时间
+// 定期清理按照延长之后的过期时间删除数据, AOF和快照只保存当前的过期时间, 恢复之后按照绝对时间过期
+func (x *xcache) SetWithOptions(key, v []byte, opts SetOptions) error {
+	_, err := x.SetWithMetaOptions(key, v, opts, Meta{})
+	return err
+}
+
+// newOptionsEntry 按照SetOptions构造待写入的数据, Exact的时候不经过SnowSlideStrategy
+// KeepTTL的时候过期时间由调用方在持有锁之后从原来的item复制
+func (x *xcache) newOptionsEntry(key, v []byte, opts SetOptions) (ent entry, err error) {
+	defer xerror.RespErr(&err)
+
+	switch {
+	case opts.KeepTTL:
+		return x.newEntryAt(key, v, neverExpire)
+	case opts.Mode != ExpireAbsolute:
+		xerror.Panic(x.checkSlide(opts))
+	}
+
+	if opts.Exact {
+		xerror.Panic(x.checkExpiration(opts.TTL))
+		ent, err = x.newEntryAt(key, v, toExpireAt(time.Now(), opts.TTL))
+	} else {
+		ent, err = x.newEntry(key, v, opts.TTL)
+	}
+	xerror.Panic(err)
+
+	if opts.Mode != ExpireAbsolute {
+		var now = time.Now()
+		ent.itm.mode = opts.Mode
+		ent.itm.idle = uint32(opts.TTL / time.Millisecond)
+		ent.itm.maxAt = neverExpire
+		if opts.Mode == ExpireIdle {
+			ent.itm.maxAt = toExpireAt(now, opts.MaxLifetime)
+		}
+		ent.itm.expireAt = ent.itm.slideTo(now.UnixNano())
+	}
+	return ent, nil
+}
+
+// keepTTL 复制原来的过期时间和过期方式
+func (i *item) keepTTL(old item) {
+	i.expireAt = old.expireAt
+	i.mode = old.mode
+	i.idle = old.idle
+	i.maxAt = old.maxAt
+}
+
+// checkSlide 滑动过期和空闲过期的参数校验, item中按照毫秒保存TTL
+func (x *xcache) checkSlide(opts SetOptions) error {
+	if opts.Mode > ExpireIdle {
+		return xerror.WrapF(ErrExpiration, "mode: %d", opts.Mode)
+	}
+
+	if opts.TTL == NoExpiration || opts.TTL/time.Millisecond > math.MaxUint32 {
+		return xerror.WrapF(ErrExpiration, "ttl: %s", opts.TTL)
+	}
+
+	if opts.Mode == ExpireIdle && opts.MaxLifetime != NoExpiration {
+		if err := x.checkExpiration(opts.MaxLifetime); err != nil {
+			return err
+		}
+
+		if opts.MaxLifetime < opts.TTL {
+			return xerror.WrapF(ErrExpiration, "ttl: %s, maxLifetime: %s", opts.TTL, opts.MaxLifetime)
+		}
+	}
+	return nil
+}
+
+// slideTo 滑动过期和空闲过期的数据命中之后的过期时间, 不超过maxAt
+func (i item) slideTo(now int64) int64 {
+	if e := now + int64(i.idle)*int64(time.Millisecond); e < i.maxAt {
+		return e
+	}
+	return i.maxAt
+}
+
+// slide 命中之后延长滑动过期和空闲过期的数据的过期时间, 调用方不能持有s.mu
+// 数据在释放读锁之后可能被修改, 需要重新查找
+func (x *xcache) slide(s *shard, keys [][]byte, hs []uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var now = time.Now().UnixNano()
+	for i, k := range keys {
+		itm, kt, existed := x.lookup(s, k, hs[i])
+		if !existed || itm.mode == ExpireAbsolute || now >= itm.expireAt {
+			continue
+		}
+
+		itm.expireAt = itm.slideTo(now)
+		s.headItem.set(string(k), hs[i], kt, itm)
+	}
+}
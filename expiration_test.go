@@ -0,0 +1,108 @@
+package xcache
+
+import (
+	"errors"
+	"github.com/pubgo/xerror"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSetWithOptions(t *testing.T) {
+	x := xerror.PanicErr(New(WithMaxExpiration(time.Hour))).(*xcache)
+	sliding, idle := []byte("hello_sliding"), []byte("hello_idle")
+
+	xerror.Panic(x.SetWithOptions(sliding, []byte("v"), SetOptions{TTL: time.Second * 10, Mode: ExpireSliding}))
+	xerror.Panic(x.SetWithOptions(idle, []byte("v"), SetOptions{TTL: time.Second * 10, Mode: ExpireIdle, MaxLifetime: time.Minute}))
+
+	// 命中之后延长过期时间
+	expireAt(x, sliding, time.Now().Add(time.Millisecond*100))
+	_, _ = x.Get(sliding)
+	if ttl, err := x.TTL(sliding); err != nil || ttl <= time.Second*9 {
+		t.Fatalf("unexpected ttl %s, %v", ttl, err)
+	}
+
+	// 空闲过期不超过最大生存时间
+	h1 := x.hashKey(idle)
+	s := x.shard(h1)
+	s.mu.Lock()
+	itm, kt, _ := x.lookup(s, idle, h1)
+	itm.maxAt = time.Now().Add(time.Second).UnixNano()
+	s.headItem.set(string(idle), h1, kt, itm)
+	s.mu.Unlock()
+
+	_, errs := x.MGet([][]byte{idle})
+	xerror.Panic(errs[0])
+	if ttl, err := x.TTL(idle); err != nil || ttl > time.Second {
+		t.Fatalf("unexpected ttl %s, %v", ttl, err)
+	}
+
+	// 定期清理按照延长之后的过期时间
+	expireAt(x, idle, time.Now().Add(-time.Millisecond))
+	xerror.Panic(x.DeleteExpired())
+	if _, err := x.Get(idle); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("expected ErrKeyNotFound, got %v", err)
+	}
+	if _, err := x.Get(sliding); err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	// Touch之后按照绝对时间过期
+	xerror.Panic(x.Touch(sliding, time.Second*5))
+	_, _, _ = x.GetWithMeta(sliding)
+	if ttl, err := x.TTL(sliding); err != nil || ttl > time.Second*5 {
+		t.Fatalf("unexpected ttl %s, %v", ttl, err)
+	}
+
+	for _, opts := range []SetOptions{
+		{TTL: time.Second * 10, Mode: ExpireIdle, MaxLifetime: time.Second * 5},
+		{TTL: NoExpiration, Mode: ExpireSliding},
+		{TTL: time.Second * 10, Mode: ExpireIdle + 1},
+	} {
+		if err := x.SetWithOptions(idle, []byte("v"), opts); !errors.Is(err, ErrExpiration) {
+			t.Fatalf("expected ErrExpiration for %+v, got %v", opts, err)
+		}
+	}
+}
+
+func TestExpirationOverflow(t *testing.T) {
+	x := xerror.PanicErr(New(WithMaxExpiration(math.MaxInt64), WithStaleTime(time.Minute))).(*xcache)
+	key := []byte("hello_overflow")
+
+	// 超过int64范围的过期时间按照永不过期处理
+	for _, e := range []time.Duration{time.Hour * 24 * 365 * 250, math.MaxInt64} {
+		xerror.Panic(x.Set(key, []byte("v"), e))
+		if _, err := x.Get(key); err != nil {
+			t.Fatalf("unexpected %v for %s", err, e)
+		}
+		if ttl, err := x.TTL(key); err != nil || ttl != NoExpiration {
+			t.Fatalf("expected NoExpiration for %s, got %s, %v", e, ttl, err)
+		}
+	}
+
+	xerror.Panic(x.Set(key, []byte("v"), math.MaxInt64-time.Hour))
+	if ttl, err := x.TTL(key); err != nil || ttl != NoExpiration {
+		t.Fatalf("expected NoExpiration, got %s, %v", ttl, err)
+	}
+}
+
+func TestSetExact(t *testing.T) {
+	x := xerror.PanicErr(New(WithMinExpiration(time.Millisecond), WithMinDataSize(1), WithSnowSlideStrategy(func(e time.Duration) time.Duration {
+		return e + time.Hour
+	}))).(*xcache)
+
+	xerror.Panic(x.SetWithOptions([]byte("k"), []byte("v"), SetOptions{TTL: time.Second * 10, Exact: true}))
+	if ttl, err := x.TTL([]byte("k")); err != nil || ttl > time.Second*10 || ttl <= time.Second*9 {
+		t.Fatalf("unexpected ttl %s, %v", ttl, err)
+	}
+
+	xerror.Panic(x.SetWithOptions([]byte("k"), []byte("v"), SetOptions{TTL: time.Millisecond * 5, Exact: true}))
+	time.Sleep(time.Millisecond * 10)
+	if _, err := x.Get([]byte("k")); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("expected ErrKeyNotFound, got %v", err)
+	}
+
+	if err := x.SetWithOptions([]byte("k"), []byte("v"), SetOptions{TTL: time.Microsecond, Exact: true}); !errors.Is(err, ErrExpiration) {
+		t.Fatalf("expected ErrExpiration, got %v", err)
+	}
+}
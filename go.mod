@@ -1,6 +1,6 @@
 module github.com/pubgo/xcache
 
-go 1.14
+go 1.20
 
 require (
 	github.com/StackExchange/wmi v0.0.0-20190523213315-cbe66965904d // indirect
@@ -16,6 +16,7 @@ require (
 	github.com/micro/micro v1.18.0 // indirect
 	github.com/minio/highwayhash v1.0.0
 	github.com/pierrec/xxHash v0.1.5
+	github.com/prometheus/client_golang v1.7.1
 	github.com/pubgo/xerror v0.1.12
 	github.com/pubgo/xtest v0.1.14
 	github.com/q191201771/pprofplus v0.0.0-20200317021942-511c6386d5ce // indirect
@@ -25,5 +26,8 @@ require (
 	github.com/spf13/cobra v1.0.0 // indirect
 	github.com/spf13/pflag v1.0.3 // indirect
 	github.com/willf/bitset v1.1.10 // indirect
+	go.opentelemetry.io/otel v1.21.0
+	go.opentelemetry.io/otel/sdk v1.21.0
+	go.opentelemetry.io/otel/trace v1.21.0
 	go.uber.org/atomic v1.6.0
 )
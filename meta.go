@@ -0,0 +1,210 @@
+package xcache
+
+import (
+	"errors"
+	"github.com/pubgo/xcache/ringbuf"
+	"github.com/pubgo/xerror"
+	"time"
+)
+
+// Meta 数据的元信息, 保存在item中
+type Meta struct {
+	// Flags 调用方自定义的标记, 例如memcached的flags
+	Flags uint32
+	// CAS 每次写入都会变化, 用于检测并发修改
+	CAS uint64
+}
+
+// GetWithMeta 获取数据和元信息, key不存在的时候不会加载数据
+func (x *xcache) GetWithMeta(key []byte) (dt []byte, meta Meta, err error) {
+	defer xerror.RespErr(&err)
+
+	xerror.Panic(x.checkKey(len(key)))
+
+	h1 := x.hashKey(key)
+	s := x.shard(h1)
+	x.record(key)
+
+	s.mu.RLock()
+	dt, itm, existed, expired := x.getItem(s, key, h1)
+	s.mu.RUnlock()
+	if existed {
+		if itm.mode != ExpireAbsolute {
+			x.slide(s, [][]byte{key}, []uint32{h1})
+		}
+		return dt, Meta{Flags: itm.flags, CAS: itm.cas}, nil
+	}
+
+	if expired {
+		// 惰性过期清理
+		go x.lazyExpire(s, [][]byte{key}, []uint32{h1})
+	}
+	return nil, Meta{}, xerror.WrapF(ErrKeyNotFound, "key: %s", key)
+}
+
+// SetWithMeta 写入数据和flags, 返回新的cas
+// meta.CAS不为0的时候, 只有key存在并且cas相同才会写入, 否则返回ErrKeyNotFound或者ErrCASMismatch
+func (x *xcache) SetWithMeta(key, v []byte, e time.Duration, meta Meta) (uint64, error) {
+	return x.SetWithMetaOptions(key, v, SetOptions{TTL: e}, meta)
+}
+
+// SetWithMetaOptions 和SetWithMeta一样, 通过SetOptions指定过期时间和过期方式
+// 检查cas, 检查key是否存在, 保留原来的过期时间和写入在同一次加锁中完成
+func (x *xcache) SetWithMetaOptions(key, v []byte, opts SetOptions, meta Meta) (cas uint64, err error) {
+	defer xerror.RespErr(&err)
+
+	ent, err := x.newOptionsEntry(key, v, opts)
+	xerror.Panic(err)
+	ent.itm.flags = meta.Flags
+
+	s := x.shard(ent.h1)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var itm item
+	switch {
+	case meta.CAS != 0:
+		itm, err = x.checkCAS(s, key, ent.h1, meta.CAS)
+	case opts.KeepTTL:
+		itm, err = x.checkAlive(s, key, ent.h1)
+	}
+	xerror.Panic(err)
+
+	if opts.NX {
+		if _, err := x.checkAlive(s, key, ent.h1); err == nil {
+			return 0, xerror.WrapF(ErrKeyExists, "key: %s", key)
+		}
+	}
+
+	if opts.KeepTTL {
+		ent.itm.keepTTL(itm)
+	}
+
+	xerror.Panic(x.setItem(s, ent))
+	itm, _, _ = x.lookup(s, key, ent.h1)
+	return itm.cas, nil
+}
+
+// GetWithVersion 获取数据和版本号, 每次写入都会分配新的版本号, 单调递增
+func (x *xcache) GetWithVersion(key []byte) ([]byte, uint64, error) {
+	dt, meta, err := x.GetWithMeta(key)
+	return dt, meta.CAS, err
+}
+
+// CompareAndSwap 只有key存在并且版本号没有变化的时候才写入, 保留原来的flags, 返回新的版本号
+// 其他写入修改了数据的时候返回ErrVersionMismatch(同时也是ErrCASMismatch), key不存在或者已经过期的时候返回ErrKeyNotFound
+func (x *xcache) CompareAndSwap(key, v []byte, version uint64, e time.Duration) (_ uint64, err error) {
+	defer xerror.RespErr(&err)
+
+	ent, err := x.newEntry(key, v, e)
+	xerror.Panic(err)
+
+	s := x.shard(ent.h1)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	itm, err := x.checkCAS(s, key, ent.h1, version)
+	if errors.Is(err, ErrCASMismatch) {
+		err = &versionErr{err: err}
+	}
+	xerror.Panic(err)
+
+	ent.itm.flags = itm.flags
+	xerror.Panic(x.setItem(s, ent))
+	itm, _, _ = x.lookup(s, key, ent.h1)
+	return itm.cas, nil
+}
+
+// SetNX key不存在或者已经过期的时候才写入, 返回是否写入, 和memcached的add一样
+func (x *xcache) SetNX(key, v []byte, e time.Duration) (bool, error) {
+	_, err := x.SetWithMetaOptions(key, v, SetOptions{TTL: e, NX: true}, Meta{})
+	if errors.Is(err, ErrKeyExists) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// DeleteWithCAS 只有key存在并且cas相同的时候才删除, 否则返回ErrKeyNotFound或者ErrCASMismatch
+func (x *xcache) DeleteWithCAS(key []byte, cas uint64) (err error) {
+	defer xerror.RespErr(&err)
+
+	xerror.Panic(x.checkKey(len(key)))
+
+	h1 := x.hashKey(key)
+	s := x.shard(h1)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err = x.checkCAS(s, key, h1, cas)
+	xerror.Panic(err)
+
+	x.delItem(s, key, h1)
+	s.stats.deletes.Inc()
+	return nil
+}
+
+// checkAlive key存在并且没有过期的时候返回当前的item, 调用方需要持有s.mu
+func (x *xcache) checkAlive(s *shard, key []byte, h1 uint32) (item, error) {
+	itm, _, existed := x.lookup(s, key, h1)
+	if !existed || itm.negative || time.Now().UnixNano() >= itm.expireAt {
+		return itm, xerror.WrapF(ErrKeyNotFound, "key: %s", key)
+	}
+	return itm, nil
+}
+
+// checkCAS key存在并且cas相同的时候返回当前的item, 调用方需要持有s.mu
+func (x *xcache) checkCAS(s *shard, key []byte, h1 uint32, cas uint64) (item, error) {
+	itm, err := x.checkAlive(s, key, h1)
+	if err != nil {
+		return itm, err
+	}
+
+	if itm.cas != cas {
+		return itm, xerror.WrapF(ErrCASMismatch, "key: %s, cas: %d, expected: %d", key, itm.cas, cas)
+	}
+	return itm, nil
+}
+
+// Flush 删除所有数据
+func (x *xcache) Flush() error {
+	for _, s := range x.shards {
+		s.mu.Lock()
+	}
+
+	// 持有所有分片的锁, 保证Flush之后的写入在AOF中排在Flush之后
+	x.aof.append(aofFlush, nil, nil, 0, 0)
+	for _, s := range x.shards {
+		x.resetShard(s)
+	}
+
+	// 持有所有分片的锁, 保证清空索引之后的写入会加入索引
+	x.resetNamespaces()
+	for _, s := range x.shards {
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// flush 删除所有数据, 不记录AOF
+func (x *xcache) flush() {
+	for _, s := range x.shards {
+		s.mu.Lock()
+		x.resetShard(s)
+		s.mu.Unlock()
+	}
+	x.resetNamespaces()
+}
+
+// resetShard 清空分片, 调用方需要持有s.mu
+func (x *xcache) resetShard(s *shard) {
+	s.rb = ringbuf.NewRingBuf()
+	s.headItem = newHeadItem()
+	s.size.Store(0)
+	s.count.Store(0)
+	if s.policy != nil {
+		s.policy = x.opts.Eviction()
+	}
+	if s.window != nil {
+		s.window = newWindow(s.window.cap)
+	}
+}
@@ -0,0 +1,212 @@
+package xcache
+
+import (
+	"bytes"
+	"errors"
+	"github.com/pubgo/xerror"
+	"go.uber.org/atomic"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMeta(t *testing.T) {
+	x := xerror.PanicErr(New()).(*xcache)
+	key := []byte("meta_key")
+
+	cas, err := x.SetWithMeta(key, []byte("v1"), time.Second*10, Meta{Flags: 7})
+	xerror.Panic(err)
+
+	val, meta, err := x.GetWithMeta(key)
+	xerror.Panic(err)
+	if string(val) != "v1" || meta.Flags != 7 || meta.CAS != cas {
+		t.Fatalf("unexpected value %s, meta %+v", val, meta)
+	}
+
+	// 任何写入都会修改cas
+	xerror.Panic(x.Set(key, []byte("v2"), time.Second*10))
+	if _, err := x.SetWithMeta(key, []byte("v3"), time.Second*10, Meta{CAS: cas}); !errors.Is(err, ErrCASMismatch) {
+		t.Fatalf("expected ErrCASMismatch, got %v", err)
+	}
+
+	_, meta, err = x.GetWithMeta(key)
+	xerror.Panic(err)
+	if meta.Flags != 0 {
+		t.Fatalf("expected Set to reset flags, got %d", meta.Flags)
+	}
+
+	if _, err := x.SetWithMeta(key, []byte("v3"), time.Second*10, Meta{CAS: meta.CAS}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := x.SetWithMeta([]byte("meta_missing"), []byte("v"), time.Second*10, Meta{CAS: 1}); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("expected ErrKeyNotFound, got %v", err)
+	}
+
+	xerror.Panic(x.Flush())
+	if x.Count() != 0 || x.Size() != 0 {
+		t.Fatalf("expected an empty cache, count %d, size %d", x.Count(), x.Size())
+	}
+}
+
+func TestMetaPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xcache")
+	xerror.Panic(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "xcache.aof")
+	x := xerror.PanicErr(New(WithAOF(path, FsyncAlways))).(*xcache)
+	_, err = x.SetWithMeta([]byte("meta_flushed"), []byte("v"), time.Second*10, Meta{Flags: 1})
+	xerror.Panic(err)
+	xerror.Panic(x.Flush())
+	_, err = x.SetWithMeta([]byte("meta_key"), []byte("v"), time.Second*10, Meta{Flags: 3})
+	xerror.Panic(err)
+	xerror.Panic(x.Close())
+
+	// AOF重放flags和flush
+	y := xerror.PanicErr(New(WithAOF(path, FsyncAlways))).(*xcache)
+	if y.Count() != 1 {
+		t.Fatalf("expected 1 item, got %d", y.Count())
+	}
+	_, meta, err := y.GetWithMeta([]byte("meta_key"))
+	xerror.Panic(err)
+	if meta.Flags != 3 {
+		t.Fatalf("expected flags 3, got %d", meta.Flags)
+	}
+
+	// 快照保存flags
+	var buf bytes.Buffer
+	xerror.Panic(y.Save(&buf))
+	xerror.Panic(y.Close())
+
+	z := xerror.PanicErr(New()).(*xcache)
+	xerror.Panic(z.Load(&buf))
+	_, meta, err = z.GetWithMeta([]byte("meta_key"))
+	xerror.Panic(err)
+	if meta.Flags != 3 {
+		t.Fatalf("expected flags 3, got %d", meta.Flags)
+	}
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	x := xerror.PanicErr(New()).(*xcache)
+	key := []byte("version_key")
+
+	if ok, err := x.SetNX(key, []byte("v1"), time.Second*10); err != nil || !ok {
+		t.Fatalf("unexpected %t, %v", ok, err)
+	}
+	if ok, err := x.SetNX(key, []byte("v2"), time.Second*10); err != nil || ok {
+		t.Fatalf("unexpected %t, %v", ok, err)
+	}
+
+	val, version, err := x.GetWithVersion(key)
+	xerror.Panic(err)
+	if string(val) != "v1" {
+		t.Fatalf("unexpected value %s", val)
+	}
+
+	next, err := x.CompareAndSwap(key, []byte("v2"), version, time.Second*10)
+	xerror.Panic(err)
+	if next <= version {
+		t.Fatalf("expected version to increase, %d <= %d", next, version)
+	}
+
+	// 其他写入修改了数据
+	_, err = x.CompareAndSwap(key, []byte("v3"), version, time.Second*10)
+	if !errors.Is(err, ErrVersionMismatch) || !errors.Is(err, ErrCASMismatch) {
+		t.Fatalf("expected ErrVersionMismatch, got %v", err)
+	}
+	if _, err := x.CompareAndSwap([]byte("version_missing"), []byte("v"), version, time.Second*10); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("expected ErrKeyNotFound, got %v", err)
+	}
+
+	// 过期的key可以重新写入
+	expireAt(x, key, time.Now().Add(-time.Millisecond))
+	if ok, err := x.SetNX(key, []byte("v4"), time.Second*10); err != nil || !ok {
+		t.Fatalf("unexpected %t, %v", ok, err)
+	}
+}
+
+func TestSetWithMetaOptions(t *testing.T) {
+	x := xerror.PanicErr(New(WithMaxExpiration(time.Hour))).(*xcache)
+	key := []byte("meta_keep")
+
+	if _, err := x.SetWithMetaOptions(key, []byte("v"), SetOptions{KeepTTL: true}, Meta{}); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("expected ErrKeyNotFound, got %v", err)
+	}
+
+	cas, err := x.SetWithMetaOptions(key, []byte("v1"), SetOptions{TTL: time.Second * 3, Exact: true}, Meta{Flags: 5})
+	xerror.Panic(err)
+
+	// 保留原来的过期时间, 不会提高到MinExpiration以上
+	expireAt(x, key, time.Now().Add(time.Second))
+	cas, err = x.SetWithMetaOptions(key, []byte("v2"), SetOptions{KeepTTL: true}, Meta{Flags: 5, CAS: cas})
+	xerror.Panic(err)
+	if ttl, err := x.TTL(key); err != nil || ttl > time.Second {
+		t.Fatalf("unexpected ttl %s, %v", ttl, err)
+	}
+
+	if _, err := x.SetWithMetaOptions(key, []byte("v3"), SetOptions{KeepTTL: true}, Meta{CAS: cas + 1}); !errors.Is(err, ErrCASMismatch) {
+		t.Fatalf("expected ErrCASMismatch, got %v", err)
+	}
+
+	dt, meta, err := x.GetWithMeta(key)
+	xerror.Panic(err)
+	if string(dt) != "v2" || meta.Flags != 5 || meta.CAS != cas {
+		t.Fatalf("unexpected %s, %+v", dt, meta)
+	}
+}
+
+func TestDeleteWithCAS(t *testing.T) {
+	x := xerror.PanicErr(New()).(*xcache)
+	key := []byte("meta_delete")
+
+	if err := x.DeleteWithCAS(key, 1); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("expected ErrKeyNotFound, got %v", err)
+	}
+
+	cas, err := x.SetWithMeta(key, []byte("v"), time.Second*10, Meta{})
+	xerror.Panic(err)
+	if err := x.DeleteWithCAS(key, cas+1); !errors.Is(err, ErrCASMismatch) {
+		t.Fatalf("expected ErrCASMismatch, got %v", err)
+	}
+	xerror.Panic(x.DeleteWithCAS(key, cas))
+	if _, err := x.Get(key); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+func TestSetNXConcurrent(t *testing.T) {
+	x := xerror.PanicErr(New()).(*xcache)
+	key := []byte("meta_nx")
+
+	var wg sync.WaitGroup
+	var added atomic.Int32
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			if i%2 == 0 {
+				var ok bool
+				if ok, err = x.SetNX(key, []byte("v"), time.Second*10); ok {
+					added.Inc()
+				}
+			} else if _, err = x.SetWithMetaOptions(key, []byte("v"), SetOptions{TTL: time.Second * 10, NX: true}, Meta{}); err == nil {
+				added.Inc()
+			}
+
+			if err != nil && !errors.Is(err, ErrKeyExists) {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if added.Load() != 1 {
+		t.Fatalf("expected exactly one write, got %d", added.Load())
+	}
+}
@@ -0,0 +1,76 @@
+package prometheus
+
+import (
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/pubgo/xcache"
+)
+
+const namespace = "xcache"
+
+var _ prom.Collector = (*Collector)(nil)
+
+// Collector 导出xcache的统计信息, 每次采集的时候读取一次Stats
+// 计数器从创建或者上一次ResetStats开始累计, ResetStats之后计数器会归零
+type Collector struct {
+	cache xcache.IXCache
+
+	hitRatio      *prom.Desc
+	hits          *prom.Desc
+	misses        *prom.Desc
+	entries       *prom.Desc
+	bytes         *prom.Desc
+	freeSlots     *prom.Desc
+	evictions     *prom.Desc
+	loaderLatency *prom.Desc
+}
+
+// NewCollector 创建Collector, name作为cache标签区分同一个进程中的多个缓存
+func NewCollector(name string, cache xcache.IXCache) *Collector {
+	var labels = prom.Labels{"cache": name}
+	var desc = func(name, help string) *prom.Desc {
+		return prom.NewDesc(prom.BuildFQName(namespace, "", name), help, nil, labels)
+	}
+
+	return &Collector{
+		cache:         cache,
+		hitRatio:      desc("hit_ratio", "Ratio of hits to lookups."),
+		hits:          desc("hits_total", "Number of lookups that found a live entry."),
+		misses:        desc("misses_total", "Number of lookups that found no live entry."),
+		entries:       desc("entries", "Number of entries."),
+		bytes:         desc("bytes", "Size of keys and values in bytes."),
+		freeSlots:     desc("free_slots", "Number of reusable slots in the RingBuf free-list queue."),
+		evictions:     desc("evictions_total", "Number of entries evicted by the eviction policy."),
+		loaderLatency: desc("loader_duration_seconds", "Latency of data loader calls."),
+	}
+}
+
+// Describe ...
+func (c *Collector) Describe(ch chan<- *prom.Desc) {
+	ch <- c.hitRatio
+	ch <- c.hits
+	ch <- c.misses
+	ch <- c.entries
+	ch <- c.bytes
+	ch <- c.freeSlots
+	ch <- c.evictions
+	ch <- c.loaderLatency
+}
+
+// Collect ...
+func (c *Collector) Collect(ch chan<- prom.Metric) {
+	var st = c.cache.Stats()
+
+	ch <- prom.MustNewConstMetric(c.hitRatio, prom.GaugeValue, st.HitRatio())
+	ch <- prom.MustNewConstMetric(c.hits, prom.CounterValue, float64(st.Hits))
+	ch <- prom.MustNewConstMetric(c.misses, prom.CounterValue, float64(st.Misses))
+	ch <- prom.MustNewConstMetric(c.entries, prom.GaugeValue, float64(c.cache.Count()))
+	ch <- prom.MustNewConstMetric(c.bytes, prom.GaugeValue, float64(c.cache.Size()))
+	ch <- prom.MustNewConstMetric(c.freeSlots, prom.GaugeValue, float64(c.cache.FreeSlots()))
+	ch <- prom.MustNewConstMetric(c.evictions, prom.CounterValue, float64(st.Evictions))
+
+	var buckets = make(map[float64]uint64, len(st.LoaderLatency.Buckets))
+	for i, b := range xcache.LoaderLatencyBuckets {
+		buckets[b.Seconds()] = st.LoaderLatency.Buckets[i]
+	}
+	ch <- prom.MustNewConstHistogram(c.loaderLatency, st.LoaderLatency.Count, st.LoaderLatency.Sum.Seconds(), buckets)
+}
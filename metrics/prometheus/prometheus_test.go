@@ -0,0 +1,68 @@
+package prometheus
+
+import (
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/pubgo/xcache"
+	"github.com/pubgo/xerror"
+	"testing"
+	"time"
+)
+
+func TestCollector(t *testing.T) {
+	cache, err := xcache.New()
+	xerror.Panic(err)
+
+	xerror.Panic(cache.Set([]byte("metrics_key"), []byte("v"), time.Second*10))
+	_, _ = cache.Get([]byte("metrics_key"))
+	_, _ = cache.GetWithDataLoad([]byte("metrics_load"), time.Second*10, func(k []byte) ([]byte, error) {
+		return []byte("v"), nil
+	})
+
+	var reg = prom.NewPedanticRegistry()
+	xerror.Panic(reg.Register(NewCollector("a", cache)))
+	// 同一个进程中的多个缓存通过cache标签区分
+	xerror.Panic(reg.Register(NewCollector("b", xerror.PanicErr(xcache.New()).(xcache.IXCache))))
+
+	mfs, err := reg.Gather()
+	xerror.Panic(err)
+
+	var values = make(map[string]float64)
+	for _, mf := range mfs {
+		if len(mf.GetMetric()) != 2 {
+			t.Fatalf("%s: expected 2 metrics, got %d", mf.GetName(), len(mf.GetMetric()))
+		}
+
+		for _, m := range mf.GetMetric() {
+			if m.GetLabel()[0].GetValue() != "a" {
+				continue
+			}
+
+			switch {
+			case m.Gauge != nil:
+				values[mf.GetName()] = m.GetGauge().GetValue()
+			case m.Counter != nil:
+				values[mf.GetName()] = m.GetCounter().GetValue()
+			case m.Histogram != nil:
+				values[mf.GetName()] = float64(m.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+
+	var expected = map[string]float64{
+		"xcache_entries":                 2,
+		"xcache_hits_total":              1,
+		"xcache_misses_total":            1,
+		"xcache_hit_ratio":               0.5,
+		"xcache_loader_duration_seconds": 1,
+		"xcache_evictions_total":         0,
+		"xcache_free_slots":              0,
+	}
+	for name, v := range expected {
+		if values[name] != v {
+			t.Fatalf("%s: expected %v, got %v", name, v, values[name])
+		}
+	}
+	if values["xcache_bytes"] == 0 {
+		t.Fatal("expected xcache_bytes")
+	}
+}
@@ -0,0 +1,517 @@
+package xcache
+
+import (
+	"bytes"
+	"context"
+	"github.com/pubgo/xerror"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NamespaceOptions namespace的配置
+type NamespaceOptions struct {
+	// 写入的过期时间为0的时候使用的过期时间, 默认是缓存的DefaultExpiration
+	DefaultExpiration time.Duration
+	// namespace中key和value的最大总长度, 超过的时候写入返回ErrNamespaceQuota, 为0的时候不限制
+	MaxBytes uint64
+}
+
+// NamespaceOption namespace的可选配置
+type NamespaceOption func(o *NamespaceOptions)
+
+// WithNamespaceExpiration namespace的默认过期时间
+func WithNamespaceExpiration(defaultExpiration time.Duration) NamespaceOption {
+	return func(o *NamespaceOptions) {
+		o.DefaultExpiration = defaultExpiration
+	}
+}
+
+// WithNamespaceQuota namespace的最大缓存
+func WithNamespaceQuota(maxBytes uint64) NamespaceOption {
+	return func(o *NamespaceOptions) {
+		o.MaxBytes = maxBytes
+	}
+}
+
+// Namespace 给key加上name+Delimiter前缀的缓存视图, 和缓存共享数据, 淘汰和统计
+// 每个namespace有自己的默认过期时间和最大缓存, 通过索引记录namespace中所有的key和长度
+type Namespace struct {
+	x      *xcache
+	name   string
+	prefix []byte
+
+	mu    sync.Mutex
+	opts  NamespaceOptions
+	keys  map[string]uint32
+	bytes uint64
+}
+
+var _ IXCache = (*Namespace)(nil)
+
+// Namespace 获取或者创建namespace, 同一个name返回同一个Namespace, opts会覆盖原来的配置
+// name不能为空, 也不能包含Delimiter, 创建的时候遍历一次缓存, 把已经存在的key加入索引
+func (x *xcache) Namespace(name string, opts ...NamespaceOption) (_ *Namespace, err error) {
+	defer xerror.RespErr(&err)
+
+	x.nsMu.Lock()
+	delimiter := x.opts.Delimiter
+	if name == "" || strings.Contains(name, delimiter) {
+		x.nsMu.Unlock()
+		return nil, xerror.WrapF(ErrNamespace, "name: %q, delimiter: %q", name, delimiter)
+	}
+
+	n, ok := x.loadNamespaces()[name]
+	if !ok {
+		n = &Namespace{
+			x:      x,
+			name:   name,
+			prefix: []byte(name + delimiter),
+			opts:   NamespaceOptions{DefaultExpiration: x.opts.DefaultExpiration},
+			keys:   make(map[string]uint32),
+		}
+	}
+	x.nsMu.Unlock()
+
+	xerror.Panic(n.apply(opts...))
+	if ok {
+		return n, nil
+	}
+
+	x.nsMu.Lock()
+	namespaces := x.loadNamespaces()
+	if exist, ok := namespaces[name]; ok {
+		// 并发创建
+		x.nsMu.Unlock()
+		return exist, exist.apply(opts...)
+	}
+
+	// 复制之后替换, 正在读取的旧表不受影响
+	var next = make(map[string]*Namespace, len(namespaces)+1)
+	for k, v := range namespaces {
+		next[k] = v
+	}
+	next[name] = n
+	x.namespaces.Store(next)
+	x.nsMu.Unlock()
+
+	// 先注册再建立索引, 注册之后的写入和删除通过setItem和removeItem更新索引
+	for _, s := range x.shards {
+		s.mu.RLock()
+		n.mu.Lock()
+		var add = func(itm itemHead) {
+			key := s.rb.Get(itm.index)[:itm.key]
+			if bytes.HasPrefix(key, n.prefix) {
+				n.set(string(key), itm.size)
+			}
+		}
+		for _, itm := range s.headItem.items {
+			add(itm)
+		}
+		for _, itm := range s.headItem.dup {
+			add(itm)
+		}
+		n.mu.Unlock()
+		s.mu.RUnlock()
+	}
+	return n, nil
+}
+
+// DeleteNamespace 通过索引删除namespace中所有的key, 不需要遍历整个缓存, namespace和配置保留
+func (x *xcache) DeleteNamespace(name string) error {
+	n, ok := x.loadNamespaces()[name]
+	if !ok {
+		return xerror.WrapF(ErrNamespace, "name: %q", name)
+	}
+
+	n.mu.Lock()
+	var keys = make([][]byte, 0, len(n.keys))
+	for k := range n.keys {
+		keys = append(keys, []byte(k))
+	}
+	n.mu.Unlock()
+
+	// 删除的时候removeItem会更新索引
+	x.MDelete(keys)
+	return nil
+}
+
+// loadNamespaces 当前的namespace表, 只读
+func (x *xcache) loadNamespaces() map[string]*Namespace {
+	return x.namespaces.Load().(map[string]*Namespace)
+}
+
+// namespaceOf 根据key的前缀找到namespace, 没有的时候返回nil, 不需要加锁
+func (x *xcache) namespaceOf(key []byte) *Namespace {
+	namespaces := x.loadNamespaces()
+	if len(namespaces) == 0 {
+		return nil
+	}
+
+	i := bytes.Index(key, x.delimiter)
+	if i <= 0 {
+		return nil
+	}
+	return namespaces[string(key[:i])]
+}
+
+// resetNamespaces Flush之后清空所有namespace的索引
+func (x *xcache) resetNamespaces() {
+	for _, n := range x.loadNamespaces() {
+		n.mu.Lock()
+		n.keys = make(map[string]uint32)
+		n.bytes = 0
+		n.mu.Unlock()
+	}
+}
+
+func (n *Namespace) apply(opts ...NamespaceOption) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	opt := n.opts
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	if err := n.x.checkExpiration(opt.DefaultExpiration); err != nil {
+		return err
+	}
+	n.opts = opt
+	return nil
+}
+
+// set 更新索引, 调用方需要持有n.mu
+func (n *Namespace) set(key string, size uint32) {
+	n.bytes = n.bytes - uint64(n.keys[key]) + uint64(size)
+	n.keys[key] = size
+}
+
+// reserve 写入之前检查最大缓存并更新索引, 调用方需要持有key所在分片的锁
+func (n *Namespace) reserve(key string, size uint32) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if bufSize := n.bytes - uint64(n.keys[key]) + uint64(size); n.opts.MaxBytes > 0 && bufSize > n.opts.MaxBytes {
+		return xerror.WrapF(ErrNamespaceQuota, "namespace: %s, bufSize: %d", n.name, bufSize)
+	}
+	n.set(key, size)
+	return nil
+}
+
+// update 更新key的大小, 不检查最大缓存, 调用方需要持有key所在分片的锁
+func (n *Namespace) update(key string, size uint32) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.set(key, size)
+}
+
+// release 删除之后更新索引, 调用方需要持有key所在分片的锁
+func (n *Namespace) release(key string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.bytes -= uint64(n.keys[key])
+	delete(n.keys, key)
+}
+
+// Name ...
+func (n *Namespace) Name() string {
+	return n.name
+}
+
+func (n *Namespace) key(k []byte) []byte {
+	return append(n.prefix[:len(n.prefix):len(n.prefix)], k...)
+}
+
+func (n *Namespace) keysOf(keys [][]byte) [][]byte {
+	var ks = make([][]byte, len(keys))
+	for i, k := range keys {
+		ks[i] = n.key(k)
+	}
+	return ks
+}
+
+// strip 去掉key的前缀
+func (n *Namespace) strip(k []byte) []byte {
+	return k[len(n.prefix):]
+}
+
+// expiration 过期时间为0的时候使用namespace的默认过期时间
+func (n *Namespace) expiration(e time.Duration) time.Duration {
+	if e != 0 {
+		return e
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.opts.DefaultExpiration
+}
+
+// loader 数据加载函数收到的是去掉前缀的key
+func (n *Namespace) loader(fn []func(ctx context.Context, k []byte) ([]byte, error)) []func(context.Context, []byte) ([]byte, error) {
+	if len(fn) == 0 || fn[0] == nil {
+		return nil
+	}
+
+	load := fn[0]
+	return []func(context.Context, []byte) ([]byte, error){func(ctx context.Context, k []byte) ([]byte, error) {
+		return load(ctx, n.strip(k))
+	}}
+}
+
+func (n *Namespace) batchLoader(fn func(ctx context.Context, keys [][]byte) ([][]byte, error)) func(context.Context, [][]byte) ([][]byte, error) {
+	if fn == nil {
+		return nil
+	}
+
+	return func(ctx context.Context, keys [][]byte) ([][]byte, error) {
+		var ks = make([][]byte, len(keys))
+		for i, k := range keys {
+			ks[i] = n.strip(k)
+		}
+		return fn(ctx, ks)
+	}
+}
+
+// Set 过期时间为0的时候使用namespace的默认过期时间, 下同
+func (n *Namespace) Set(k, v []byte, e time.Duration) error {
+	return n.SetCtx(context.Background(), k, v, e)
+}
+
+func (n *Namespace) Get(k []byte) ([]byte, error) {
+	return n.GetCtx(context.Background(), k)
+}
+
+func (n *Namespace) GetSet(k, v []byte, e time.Duration) ([]byte, error) {
+	return n.GetSetCtx(context.Background(), k, v, e)
+}
+
+func (n *Namespace) GetWithDataLoad(k []byte, e time.Duration, fn ...func(k []byte) (v []byte, err error)) ([]byte, error) {
+	return n.GetWithDataLoadCtx(context.Background(), k, e, withCtx(fn)...)
+}
+
+func (n *Namespace) Delete(k []byte) error {
+	return n.DeleteCtx(context.Background(), k)
+}
+
+// DeleteExpired 清理整个缓存的过期数据
+func (n *Namespace) DeleteExpired() error {
+	return n.x.DeleteExpired()
+}
+
+func (n *Namespace) TTL(k []byte) (time.Duration, error) {
+	return n.x.TTL(n.key(k))
+}
+
+func (n *Namespace) Expire(k []byte, e time.Duration) error {
+	return n.x.Expire(n.key(k), n.expiration(e))
+}
+
+func (n *Namespace) Touch(k []byte, e time.Duration) error {
+	return n.x.Touch(n.key(k), n.expiration(e))
+}
+
+func (n *Namespace) SetWithOptions(k, v []byte, opts SetOptions) error {
+	opts.TTL = n.expiration(opts.TTL)
+	return n.x.SetWithOptions(n.key(k), v, opts)
+}
+
+func (n *Namespace) IncrBy(k []byte, delta int64, e time.Duration) (int64, error) {
+	return n.x.IncrBy(n.key(k), delta, n.expiration(e))
+}
+
+func (n *Namespace) DecrBy(k []byte, delta int64, e time.Duration) (int64, error) {
+	return n.x.DecrBy(n.key(k), delta, n.expiration(e))
+}
+
+func (n *Namespace) GetAndTouch(k []byte, e time.Duration) ([]byte, error) {
+	return n.x.GetAndTouch(n.key(k), n.expiration(e))
+}
+
+func (n *Namespace) Persist(k []byte) error {
+	return n.x.Persist(n.key(k))
+}
+
+func (n *Namespace) GetWithMeta(k []byte) ([]byte, Meta, error) {
+	return n.x.GetWithMeta(n.key(k))
+}
+
+func (n *Namespace) SetWithMeta(k, v []byte, e time.Duration, meta Meta) (uint64, error) {
+	return n.x.SetWithMeta(n.key(k), v, n.expiration(e), meta)
+}
+
+func (n *Namespace) SetWithMetaOptions(k, v []byte, opts SetOptions, meta Meta) (uint64, error) {
+	opts.TTL = n.expiration(opts.TTL)
+	return n.x.SetWithMetaOptions(n.key(k), v, opts, meta)
+}
+
+func (n *Namespace) DeleteWithCAS(k []byte, cas uint64) error {
+	return n.x.DeleteWithCAS(n.key(k), cas)
+}
+
+func (n *Namespace) GetWithVersion(k []byte) ([]byte, uint64, error) {
+	return n.x.GetWithVersion(n.key(k))
+}
+
+func (n *Namespace) CompareAndSwap(k, v []byte, version uint64, e time.Duration) (uint64, error) {
+	return n.x.CompareAndSwap(n.key(k), v, version, n.expiration(e))
+}
+
+func (n *Namespace) SetNX(k, v []byte, e time.Duration) (bool, error) {
+	return n.x.SetNX(n.key(k), v, n.expiration(e))
+}
+
+// Range 遍历namespace中没有过期的数据, k是去掉前缀的key
+func (n *Namespace) Range(fn func(k, v []byte, ttl time.Duration) bool) {
+	n.x.Range(func(k, v []byte, ttl time.Duration) bool {
+		if !bytes.HasPrefix(k, n.prefix) {
+			return true
+		}
+		return fn(n.strip(k), v, ttl)
+	})
+}
+
+// Scan 遍历namespace中没有过期的key, 返回去掉前缀的key
+func (n *Namespace) Scan(cursor uint64, count int, match string) ([][]byte, uint64) {
+	if match == "" {
+		match = "*"
+	}
+
+	keys, next := n.x.Scan(cursor, count, escapeGlob(string(n.prefix))+match)
+	for i := range keys {
+		keys[i] = n.strip(keys[i])
+	}
+	return keys, next
+}
+
+// Flush 删除namespace中所有的key
+func (n *Namespace) Flush() error {
+	return n.x.DeleteNamespace(n.name)
+}
+
+func (n *Namespace) GetCtx(ctx context.Context, k []byte) ([]byte, error) {
+	return n.x.GetCtx(ctx, n.key(k))
+}
+
+func (n *Namespace) SetCtx(ctx context.Context, k, v []byte, e time.Duration) error {
+	return n.x.SetCtx(ctx, n.key(k), v, n.expiration(e))
+}
+
+func (n *Namespace) GetSetCtx(ctx context.Context, k, v []byte, e time.Duration) ([]byte, error) {
+	return n.x.GetSetCtx(ctx, n.key(k), v, n.expiration(e))
+}
+
+func (n *Namespace) GetWithDataLoadCtx(ctx context.Context, k []byte, e time.Duration, fn ...func(ctx context.Context, k []byte) (v []byte, err error)) ([]byte, error) {
+	return n.x.GetWithDataLoadCtx(ctx, n.key(k), n.expiration(e), n.loader(fn)...)
+}
+
+func (n *Namespace) DeleteCtx(ctx context.Context, k []byte) error {
+	return n.x.DeleteCtx(ctx, n.key(k))
+}
+
+func (n *Namespace) DeleteExpiredCtx(ctx context.Context) error {
+	return n.x.DeleteExpiredCtx(ctx)
+}
+
+func (n *Namespace) MGet(keys [][]byte) ([][]byte, []error) {
+	return n.MGetCtx(context.Background(), keys)
+}
+
+func (n *Namespace) MSet(keys, vals [][]byte, e time.Duration) []error {
+	return n.MSetCtx(context.Background(), keys, vals, e)
+}
+
+func (n *Namespace) MDelete(keys [][]byte) []error {
+	return n.MDeleteCtx(context.Background(), keys)
+}
+
+func (n *Namespace) MGetWithDataLoad(keys [][]byte, e time.Duration, fn func(keys [][]byte) ([][]byte, error)) ([][]byte, []error) {
+	var load func(context.Context, [][]byte) ([][]byte, error)
+	if fn != nil {
+		load = func(_ context.Context, keys [][]byte) ([][]byte, error) {
+			return fn(keys)
+		}
+	}
+	return n.MGetWithDataLoadCtx(context.Background(), keys, e, load)
+}
+
+func (n *Namespace) MGetCtx(ctx context.Context, keys [][]byte) ([][]byte, []error) {
+	return n.x.MGetCtx(ctx, n.keysOf(keys))
+}
+
+func (n *Namespace) MSetCtx(ctx context.Context, keys, vals [][]byte, e time.Duration) []error {
+	return n.x.MSetCtx(ctx, n.keysOf(keys), vals, n.expiration(e))
+}
+
+func (n *Namespace) MDeleteCtx(ctx context.Context, keys [][]byte) []error {
+	return n.x.MDeleteCtx(ctx, n.keysOf(keys))
+}
+
+func (n *Namespace) MGetWithDataLoadCtx(ctx context.Context, keys [][]byte, e time.Duration, fn func(ctx context.Context, keys [][]byte) ([][]byte, error)) ([][]byte, []error) {
+	return n.x.MGetWithDataLoadCtx(ctx, n.keysOf(keys), n.expiration(e), n.batchLoader(fn))
+}
+
+// Size namespace中key和value的总长度
+func (n *Namespace) Size() uint32 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return uint32(n.bytes)
+}
+
+// Count namespace中key的数量, 包括过期还没有删除的key
+func (n *Namespace) Count() uint32 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return uint32(len(n.keys))
+}
+
+// FreeSlots 整个缓存的空闲位置
+func (n *Namespace) FreeSlots() uint32 {
+	return n.x.FreeSlots()
+}
+
+func (n *Namespace) AddKnownKeys(keys ...[]byte) error {
+	return n.x.AddKnownKeys(n.keysOf(keys)...)
+}
+
+// Stats 整个缓存的统计
+func (n *Namespace) Stats() Stats {
+	return n.x.Stats()
+}
+
+// ResetStats 清空整个缓存的统计
+func (n *Namespace) ResetStats() {
+	n.x.ResetStats()
+}
+
+// Init 只使用opts中的DefaultExpiration, 作为namespace的默认过期时间
+func (n *Namespace) Init(opts ...Option) error {
+	opt := n.Option()
+	for _, o := range opts {
+		o(&opt)
+	}
+	return n.apply(WithNamespaceExpiration(opt.DefaultExpiration))
+}
+
+// Option 缓存的配置, DefaultExpiration是namespace的默认过期时间
+func (n *Namespace) Option() Options {
+	opt := n.x.Option()
+	n.mu.Lock()
+	opt.DefaultExpiration = n.opts.DefaultExpiration
+	n.mu.Unlock()
+	return opt
+}
+
+// escapeGlob 转义matchGlob中的特殊字符
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c == '*' || c == '?' || c == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
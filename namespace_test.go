@@ -0,0 +1,155 @@
+package xcache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/pubgo/xerror"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNamespace(t *testing.T) {
+	x := xerror.PanicErr(New()).(*xcache)
+
+	// 创建之前已经存在的key会加入索引
+	xerror.Panic(x.Set([]byte("user##old"), []byte("v"), time.Second*10))
+
+	user := xerror.PanicErr(x.Namespace("user", WithNamespaceExpiration(time.Second*20), WithNamespaceQuota(100))).(*Namespace)
+	if same := xerror.PanicErr(x.Namespace("user")).(*Namespace); same != user {
+		t.Fatal("expected the same namespace")
+	}
+	order := xerror.PanicErr(x.Namespace("order")).(*Namespace)
+
+	// 过期时间为0的时候使用namespace的默认过期时间
+	xerror.Panic(user.Set([]byte("name1"), []byte("value"), 0))
+	if ttl, err := x.TTL([]byte("user##name1")); err != nil || ttl <= time.Second*10 {
+		t.Fatalf("unexpected ttl %s, %v", ttl, err)
+	}
+	xerror.Panic(order.Set([]byte("name1"), []byte("other"), time.Second*10))
+
+	if val, err := user.Get([]byte("name1")); err != nil || string(val) != "value" {
+		t.Fatalf("unexpected %s, %v", val, err)
+	}
+
+	val, err := user.GetWithDataLoadCtx(context.Background(), []byte("load1"), 0, func(ctx context.Context, k []byte) ([]byte, error) {
+		return k, nil
+	})
+	if err != nil || string(val) != "load1" {
+		t.Fatalf("unexpected %s, %v", val, err)
+	}
+
+	// user##old(9+1) + user##name1(11+5) + user##load1(11+5)
+	if user.Count() != 3 || user.Size() != 42 {
+		t.Fatalf("unexpected count %d, size %d", user.Count(), user.Size())
+	}
+
+	if err := user.Set([]byte("name2"), make([]byte, 100), 0); !errors.Is(err, ErrNamespaceQuota) {
+		t.Fatalf("expected ErrNamespaceQuota, got %v", err)
+	}
+
+	// 直接删除缓存中的key也会更新索引
+	xerror.Panic(x.Delete([]byte("user##old")))
+	keys, _ := user.Scan(0, 100, "name*")
+	if len(keys) != 1 || string(keys[0]) != "name1" || user.Count() != 2 {
+		t.Fatalf("unexpected %q, count %d", keys, user.Count())
+	}
+
+	xerror.Panic(x.DeleteNamespace("user"))
+	if user.Count() != 0 || user.Size() != 0 {
+		t.Fatalf("unexpected count %d, size %d", user.Count(), user.Size())
+	}
+	if _, err := user.Get([]byte("name1")); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("expected ErrKeyNotFound, got %v", err)
+	}
+	if val, err := order.Get([]byte("name1")); err != nil || string(val) != "other" {
+		t.Fatalf("unexpected %s, %v", val, err)
+	}
+
+	xerror.Panic(x.Flush())
+	if order.Count() != 0 {
+		t.Fatalf("unexpected count %d", order.Count())
+	}
+
+	if _, err := x.Namespace("a##b"); !errors.Is(err, ErrNamespace) {
+		t.Fatalf("expected ErrNamespace, got %v", err)
+	}
+	if err := x.Init(WithDelimiter(":")); !errors.Is(err, ErrNamespace) {
+		t.Fatalf("expected ErrNamespace, got %v", err)
+	}
+
+	// 校验失败的时候不修改分片
+	shards := x.shards
+	if err := x.Init(WithShardCount(4), WithDelimiter(":")); !errors.Is(err, ErrNamespace) || len(x.shards) != len(shards) || x.shards[0] != shards[0] {
+		t.Fatalf("expected ErrNamespace without changing shards, got %v", err)
+	}
+	if err := x.DeleteNamespace("missing"); !errors.Is(err, ErrNamespace) {
+		t.Fatalf("expected ErrNamespace, got %v", err)
+	}
+}
+
+func TestNamespaceQuotaWithEviction(t *testing.T) {
+	const bufSize = 10 << 20
+	x := xerror.PanicErr(New(WithEvictionPolicy(NewLRUPolicy))).(*xcache)
+	xerror.Panic(x.Init(func(o *Options) { o.MaxBufSize, o.ShardCount = bufSize, 1 }))
+
+	user := xerror.PanicErr(x.Namespace("user", WithNamespaceQuota(40<<10))).(*Namespace)
+	val := bytes.Repeat([]byte("v"), 30<<10)
+	xerror.Panic(user.Set([]byte("name1"), val, time.Second*10))
+	for i := 0; x.Stats().Evictions == 0; i++ {
+		xerror.Panic(x.Set([]byte(fmt.Sprintf("quota_%d", i)), val, time.Second*10))
+		xerror.PanicErr(user.Get([]byte("name1")))
+	}
+
+	// 超过namespace的最大缓存的时候不淘汰其他数据
+	var evictions = x.Stats().Evictions
+	if err := user.Set([]byte("name2"), val, time.Second*10); !errors.Is(err, ErrNamespaceQuota) {
+		t.Fatalf("expected ErrNamespaceQuota, got %v", err)
+	}
+	if x.Stats().Evictions != evictions {
+		t.Fatalf("unexpected evictions %d", x.Stats().Evictions-evictions)
+	}
+
+	// 淘汰当前的key之后索引和分片中的数据一致
+	for i := 0; user.Count() > 0; i++ {
+		xerror.Panic(x.Set([]byte(fmt.Sprintf("other_%d", i)), val, time.Second*10))
+	}
+	if user.Size() != 0 {
+		t.Fatalf("unexpected size %d", user.Size())
+	}
+}
+
+func TestNamespaceConcurrent(t *testing.T) {
+	x := xerror.PanicErr(New()).(*xcache)
+
+	// 创建namespace的同时写入, 写入读取的前缀表是快照
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		name := fmt.Sprintf("ns%d", i)
+		go func() {
+			defer wg.Done()
+			_, err := x.Namespace(name)
+			xerror.Panic(err)
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				xerror.Panic(x.Set([]byte(fmt.Sprintf("%s##key%d", name, j)), []byte("v"), time.Second*10))
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(x.loadNamespaces()) != 8 {
+		t.Fatalf("expected 8 namespaces, got %d", len(x.loadNamespaces()))
+	}
+	for i := 0; i < 8; i++ {
+		n := xerror.PanicErr(x.Namespace(fmt.Sprintf("ns%d", i))).(*Namespace)
+		if len(n.keys) != 100 {
+			t.Fatalf("expected 100 keys in ns%d, got %d", i, len(n.keys))
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package xcache
 
 import (
+	"context"
 	"time"
 )
 
@@ -11,7 +12,7 @@ func WithDefaultExpiration(defaultExpiration time.Duration) Option {
 	}
 }
 
-// WithMinExpiration ...
+// WithMinExpiration 最小过期时间, 不能小于MinExpirationLimit
 func WithMinExpiration(minExpiration time.Duration) Option {
 	return func(o *Options) {
 		o.MinExpiration = minExpiration
@@ -32,7 +33,7 @@ func WithMinBufSize(minBufSize int) Option {
 	}
 }
 
-// WithMinDataSize ...
+// WithMinDataSize key的最小长度, 不能小于MinDataSizeLimit
 func WithMinDataSize(minDataSize int) Option {
 	return func(o *Options) {
 		o.MinDataSize = minDataSize
@@ -46,6 +47,50 @@ func WithMaxDataSize(maxDataSize int) Option {
 	}
 }
 
+// WithMaxKeySize key的最大长度, 不能超过KeySizeLimit和MaxDataSize
+func WithMaxKeySize(maxKeySize int) Option {
+	return func(o *Options) {
+		o.MaxKeySize = maxKeySize
+	}
+}
+
+// WithDelimiter namespace和key之间的分隔符, 已经有namespace的时候不能修改
+func WithDelimiter(delimiter string) Option {
+	return func(o *Options) {
+		o.Delimiter = delimiter
+	}
+}
+
+// WithNegativeTTL 数据加载函数返回ErrNotExist的时候, 缓存不存在的标记的时间
+func WithNegativeTTL(negativeTTL time.Duration) Option {
+	return func(o *Options) {
+		o.NegativeTTL = negativeTTL
+	}
+}
+
+// WithStaleTime 过期之后staleTime以内, GetWithDataLoad返回旧数据并且在后台刷新
+func WithStaleTime(staleTime time.Duration) Option {
+	return func(o *Options) {
+		o.StaleTime = staleTime
+	}
+}
+
+// WithBloomFilter 开启布隆过滤器防止穿透, n是预计的key数量, fp是误判率
+// 布隆过滤器通过AddKnownKeys和数据加载函数返回的数据添加key
+func WithBloomFilter(n int, fp float64) Option {
+	return func(o *Options) {
+		o.BloomSize = n
+		o.BloomFP = fp
+	}
+}
+
+// WithXFetch 开启XFetch提前刷新, beta一般设置为1
+func WithXFetch(beta float64) Option {
+	return func(o *Options) {
+		o.XFetchBeta = beta
+	}
+}
+
 // WithDataLoadTime ...
 func WithDataLoadTime(mataLoadTime time.Duration) Option {
 	return func(o *Options) {
@@ -60,6 +105,13 @@ func WithClearTime(clearTime time.Duration) Option {
 	}
 }
 
+// WithShardCount ...
+func WithShardCount(shardCount int) Option {
+	return func(o *Options) {
+		o.ShardCount = shardCount
+	}
+}
+
 func WithClearNum(clearRate float32) Option {
 	return func(o *Options) {
 		o.ClearRate = clearRate
@@ -72,7 +124,7 @@ func WithSnowSlideStrategy(snowSlideStrategy func(expired time.Duration) time.Du
 	}
 }
 
-func WithPenetrateStrategy(penetrateStrategy func(k []byte, fn ...func(k []byte) ([]byte, error)) ([]byte, error)) Option {
+func WithPenetrateStrategy(penetrateStrategy func(ctx context.Context, k []byte, fn ...func(ctx context.Context, k []byte) ([]byte, error)) ([]byte, error)) Option {
 	return func(o *Options) {
 		o.PenetrateStrategy = penetrateStrategy
 	}
@@ -83,3 +135,40 @@ func WithBreakdownStrategy(breakdownStrategy func([]byte, []byte, time.Duration)
 		o.BreakdownStrategy = breakdownStrategy
 	}
 }
+
+// WithEvictionPolicy 设置淘汰策略, 例如: WithEvictionPolicy(NewLRUPolicy)
+func WithEvictionPolicy(newPolicy func() EvictionPolicy) Option {
+	return func(o *Options) {
+		o.Eviction = newPolicy
+	}
+}
+
+// WithAdmissionPolicy 设置准入策略, 和淘汰策略一起组成W-TinyLFU, 例如:
+// WithAdmissionPolicy(func() AdmissionPolicy { return tinylfu.New(100000) })
+func WithAdmissionPolicy(newPolicy func() AdmissionPolicy) Option {
+	return func(o *Options) {
+		o.Admission = newPolicy
+	}
+}
+
+// WithTracer 设置链路追踪, 例如OpenTelemetry: WithTracer(otel.NewTracer(nil))
+func WithTracer(tracer Tracer) Option {
+	return func(o *Options) {
+		o.Tracer = tracer
+	}
+}
+
+// WithAOF 开启AOF, 每次写入, 删除和过期都会追加到path
+func WithAOF(path string, policy FsyncPolicy) Option {
+	return func(o *Options) {
+		o.AOFPath = path
+		o.AOFSync = policy
+	}
+}
+
+// WithAOFRewriteSize ...
+func WithAOFRewriteSize(rewriteSize int64) Option {
+	return func(o *Options) {
+		o.AOFRewriteSize = rewriteSize
+	}
+}
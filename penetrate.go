@@ -0,0 +1,72 @@
+package xcache
+
+import (
+	"github.com/cespare/xxhash"
+	"github.com/pubgo/xcache/bloom"
+	"github.com/pubgo/xerror"
+	"sync"
+)
+
+// knownKeys 用布隆过滤器记录已知存在的key, 一定不存在的key不调用数据加载函数, 防止穿透
+type knownKeys struct {
+	mu     sync.RWMutex
+	filter *bloom.Scalable
+}
+
+func (k *knownKeys) add(h uint64) {
+	k.mu.Lock()
+	k.filter.Add(h)
+	k.mu.Unlock()
+}
+
+func (k *knownKeys) has(h uint64) bool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.filter.Has(h)
+}
+
+// initKnownKeys BloomSize或者BloomFP修改的时候重新创建布隆过滤器, 已经添加的key会丢失
+func (x *xcache) initKnownKeys(opt Options) {
+	if x.known != nil && opt.BloomSize == x.opts.BloomSize && opt.BloomFP == x.opts.BloomFP {
+		return
+	}
+
+	x.known = nil
+	if opt.BloomSize > 0 {
+		x.known = &knownKeys{filter: bloom.NewScalable(opt.BloomSize, opt.BloomFP)}
+	}
+}
+
+// AddKnownKeys 把已知存在的key添加到布隆过滤器, 例如启动的时候添加数据库中所有的id
+// 没有开启布隆过滤器的时候返回ErrBloomFilter
+func (x *xcache) AddKnownKeys(keys ...[]byte) error {
+	var known = x.known
+	if known == nil {
+		return xerror.WrapF(ErrBloomFilter, "keys: %d", len(keys))
+	}
+
+	known.mu.Lock()
+	defer known.mu.Unlock()
+	for _, k := range keys {
+		known.filter.Add(xxhash.Sum64(k))
+	}
+	return nil
+}
+
+// mayExist 布隆过滤器判断key是否可能存在, 没有开启布隆过滤器的时候返回true
+func (x *xcache) mayExist(k []byte) bool {
+	var known = x.known
+	if known == nil || known.has(xxhash.Sum64(k)) {
+		return true
+	}
+
+	x.loaderStats.bloomRejected.Inc()
+	return false
+}
+
+// addKnown 数据加载函数返回了不为空的数据, 说明key存在
+func (x *xcache) addKnown(k []byte, dt []byte) {
+	if known := x.known; known != nil && len(dt) > 0 {
+		known.add(xxhash.Sum64(k))
+	}
+}
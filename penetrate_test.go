@@ -0,0 +1,55 @@
+package xcache
+
+import (
+	"errors"
+	"github.com/pubgo/xerror"
+	"testing"
+	"time"
+)
+
+func TestBloomFilter(t *testing.T) {
+	x := xerror.PanicErr(New(WithBloomFilter(1000, 0.01))).(*xcache)
+
+	var calls int
+	load := func(k []byte) ([]byte, error) {
+		calls++
+		return []byte("v"), nil
+	}
+
+	// 不在布隆过滤器中的key不调用数据加载函数
+	if _, err := x.GetWithDataLoad([]byte("bloom_missing"), time.Second*10, load); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("expected ErrKeyNotFound, got %v", err)
+	}
+	if calls != 0 || x.Stats().BloomRejected != 1 {
+		t.Fatalf("unexpected calls %d, stats %+v", calls, x.Stats())
+	}
+
+	xerror.Panic(x.AddKnownKeys([]byte("bloom_known"), []byte("bloom_batch")))
+	if val, err := x.GetWithDataLoad([]byte("bloom_known"), time.Second*10, load); err != nil || string(val) != "v" {
+		t.Fatalf("unexpected %s, %v", val, err)
+	}
+
+	var batchKeys [][]byte
+	vals, errs := x.MGetWithDataLoad([][]byte{[]byte("bloom_batch"), []byte("bloom_absent")}, time.Second*10, func(keys [][]byte) ([][]byte, error) {
+		batchKeys = keys
+		return [][]byte{[]byte("v")}, nil
+	})
+	if len(batchKeys) != 1 || string(vals[0]) != "v" || !errors.Is(errs[1], ErrKeyNotFound) {
+		t.Fatalf("unexpected %q, %v, %q", vals, errs, batchKeys)
+	}
+
+	// 修改布隆过滤器的配置会清空已知的key
+	xerror.Panic(x.Init(WithBloomFilter(2000, 0.01)))
+	xerror.Panic(x.Delete([]byte("bloom_known")))
+	if _, err := x.GetWithDataLoad([]byte("bloom_known"), time.Second*10, load); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("expected ErrKeyNotFound, got %v", err)
+	}
+
+	xerror.Panic(x.Init(WithBloomFilter(0, 0)))
+	if err := x.AddKnownKeys([]byte("bloom_known")); !errors.Is(err, ErrBloomFilter) {
+		t.Fatalf("expected ErrBloomFilter, got %v", err)
+	}
+	if _, err := x.GetWithDataLoad([]byte("bloom_known"), time.Second*10, load); err != nil || calls != 2 {
+		t.Fatalf("unexpected calls %d, %v", calls, err)
+	}
+}
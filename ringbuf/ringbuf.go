@@ -37,6 +37,11 @@ func (r *ringBuf) Get(u uint32) []byte {
 	return r.data[u]
 }
 
+// FreeSlots 空闲队列中可以复用的位置数量
+func (r *ringBuf) FreeSlots() int {
+	return r.q.Len()
+}
+
 func newRingBuf() *ringBuf {
 	return &ringBuf{data: make([][]byte, 0)}
 }
@@ -0,0 +1,147 @@
+package xcache
+
+import (
+	"time"
+)
+
+// defaultScanCount Scan的count小于等于0的时候每次检查的key数量
+const defaultScanCount = 10
+
+// Range 遍历所有没有过期的数据, fn返回false的时候停止, 永不过期的数据ttl为NoExpiration
+// 每个分片复制数据的引用之后释放锁再调用fn, fn中可以读写缓存, k和v不能修改
+func (x *xcache) Range(fn func(k, v []byte, ttl time.Duration) bool) {
+	for _, s := range x.shards {
+		var now = time.Now().UnixNano()
+		for _, ent := range x.snapshotShard(s, now) {
+			var ttl = time.Duration(ent.ttl)
+			if ent.ttl == neverExpire-now {
+				ttl = NoExpiration
+			}
+
+			if !fn(ent.key[:len(ent.key):len(ent.key)], ent.val, ttl) {
+				return
+			}
+		}
+	}
+}
+
+// scanEntry Scan在分片中找到的key
+type scanEntry struct {
+	h1  uint32
+	key []byte
+}
+
+// Scan 从cursor开始遍历没有过期的key, 每次大约检查count个key, 返回下一次的cursor, 返回0的时候遍历结束
+// cursor的高32位是分片, 低32位是key的hash, 分片中通过有序的hash索引从cursor开始遍历, 每次只持有一个分片的读锁
+// 遍历期间一直存在的key一定会返回, 只返回一次, match为空的时候不过滤, 支持*和?通配符
+func (x *xcache) Scan(cursor uint64, count int, match string) (keys [][]byte, next uint64) {
+	if count <= 0 {
+		count = defaultScanCount
+	}
+
+	var shards = x.shards
+	for si := cursor >> 32; si < uint64(len(shards)); si++ {
+		ents, n, h1, more := x.scanShard(shards[si], uint32(cursor), count)
+		for _, ent := range ents {
+			if match == "" || matchGlob(match, string(ent.key)) {
+				keys = append(keys, ent.key)
+			}
+		}
+
+		// 相同hash的key在同一次返回, 下一次从下一个hash开始, h1大于上一个hash, 不会回绕到0
+		if more {
+			return keys, si<<32 | uint64(h1)
+		}
+
+		cursor = 0
+		if count -= n; count <= 0 && si+1 < uint64(len(shards)) {
+			return keys, (si + 1) << 32
+		}
+	}
+	return keys, 0
+}
+
+// scanShard 从hash大于等于start的key开始检查, 返回没有过期的key和检查的数量, 相同hash的key不会被分开
+// 检查了count个之后more为true, next是下一个没有检查的hash
+func (x *xcache) scanShard(s *shard, start uint32, count int) (ents []scanEntry, n int, next uint32, more bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// hash冲突的key很少, 按照hash分组
+	var dup map[uint32][]string
+	if len(s.headItem.dup) > 0 {
+		dup = make(map[uint32][]string, len(s.headItem.dup))
+		for k := range s.headItem.dup {
+			h1 := x.hashKey([]byte(k))
+			dup[h1] = append(dup[h1], k)
+		}
+	}
+
+	var now = time.Now().UnixNano()
+	var add = func(h1 uint32, key []byte, itm itemHead) {
+		if itm.negative || itm.expireAt <= now {
+			return
+		}
+		ents = append(ents, scanEntry{h1: h1, key: key[:len(key):len(key)]})
+	}
+
+	var last uint32
+	s.headItem.index.seek(start, func(h1 uint32) bool {
+		if n > 0 && h1 == last {
+			n++
+			return true
+		}
+
+		if n >= count {
+			next, more = h1, true
+			return false
+		}
+
+		n++
+		last = h1
+		if itm, ok := s.headItem.items[h1]; ok {
+			add(h1, s.rb.Get(itm.index)[:itm.key], itm)
+		}
+		for _, k := range dup[h1] {
+			add(h1, []byte(k), s.headItem.dup[k])
+		}
+		return true
+	})
+	return ents, n, next, more
+}
+
+// matchGlob 和redis的SCAN MATCH一样, *匹配任意多个字符, ?匹配一个字符, \转义
+func matchGlob(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if matchGlob(pattern, s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return len(s) == 0
+}
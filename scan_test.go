@@ -0,0 +1,170 @@
+package xcache
+
+import (
+	"fmt"
+	"github.com/pubgo/xerror"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestScan(t *testing.T) {
+	x := xerror.PanicErr(New()).(*xcache)
+	for i := 0; i < 200; i++ {
+		xerror.Panic(x.Set([]byte(fmt.Sprintf("scan_%03d", i)), []byte("v"), time.Second*10))
+	}
+	xerror.Panic(x.Set([]byte("scan_forever"), []byte("v"), NoExpiration))
+	expireAt(x, []byte("scan_000"), time.Now().Add(-time.Millisecond))
+
+	var seen = make(map[string]int)
+	var cursor uint64
+	for calls := 0; ; calls++ {
+		if calls > 1000 {
+			t.Fatal("scan does not terminate")
+		}
+
+		var keys [][]byte
+		keys, cursor = x.Scan(cursor, 7, "")
+		for _, k := range keys {
+			seen[string(k)]++
+		}
+		if cursor == 0 {
+			break
+		}
+	}
+
+	// 过期的key跳过, 其他的key只返回一次
+	if len(seen) != 200 || seen["scan_000"] != 0 || seen["scan_forever"] != 1 {
+		t.Fatalf("unexpected %d keys", len(seen))
+	}
+	for k, n := range seen {
+		if n != 1 {
+			t.Fatalf("key %s returned %d times", k, n)
+		}
+	}
+
+	keys, cursor := x.Scan(0, 1000, "scan_1?5")
+	if len(keys) != 10 || cursor != 0 {
+		t.Fatalf("unexpected %q, %d", keys, cursor)
+	}
+
+	var n int
+	x.Range(func(k, v []byte, ttl time.Duration) bool {
+		if string(k) == "scan_forever" && ttl != NoExpiration {
+			t.Fatalf("expected NoExpiration, got %s", ttl)
+		}
+		n++
+		return n < 50
+	})
+	if n != 50 {
+		t.Fatalf("expected Range to stop at 50, got %d", n)
+	}
+}
+
+func TestScanMaxHash(t *testing.T) {
+	x := xerror.PanicErr(New(WithShardCount(1))).(*xcache)
+	for _, k := range []string{"scan_a", "scan_b", "scan_c"} {
+		xerror.Panic(x.Set([]byte(k), []byte("v"), time.Second*10))
+	}
+
+	// 把scan_c移动到最大的hash, 下一次的cursor不能回绕到0
+	s := x.shards[0]
+	key := []byte("scan_c")
+	h1 := x.hashKey(key)
+	s.mu.Lock()
+	itm, kt, _ := x.lookup(s, key, h1)
+	s.headItem.del(string(key), h1, kt)
+	s.headItem.set(string(key), math.MaxUint32, keyIndex, itm)
+	s.mu.Unlock()
+
+	var seen = make(map[string]int)
+	var cursor uint64
+	for calls := 0; ; calls++ {
+		if calls > 10 {
+			t.Fatal("scan does not terminate")
+		}
+
+		var keys [][]byte
+		keys, cursor = x.Scan(cursor, 1, "")
+		for _, k := range keys {
+			seen[string(k)]++
+		}
+		if cursor == 0 {
+			break
+		}
+	}
+
+	if len(seen) != 3 || seen["scan_c"] != 1 {
+		t.Fatalf("unexpected %v", seen)
+	}
+}
+
+func TestScanBounded(t *testing.T) {
+	x := xerror.PanicErr(New(WithShardCount(1), WithMaxExpiration(time.Hour))).(*xcache)
+	for i := 0; i < 5000; i++ {
+		xerror.Panic(x.Set([]byte(fmt.Sprintf("scan_%04d", i)), []byte("v"), time.Second*10))
+	}
+
+	// 每次只检查count个key, 不遍历整个分片
+	ents, n, next, more := x.scanShard(x.shards[0], 0, 10)
+	if len(ents) != 10 || n != 10 || !more || next <= ents[9].h1 {
+		t.Fatalf("unexpected %d, %d, %d, %t", len(ents), n, next, more)
+	}
+}
+
+func TestHashIndex(t *testing.T) {
+	var idx hashIndex
+	var ref []uint32
+	for i := 0; i < 5000; i++ {
+		h1 := uint32(rand.Intn(2000))
+		if i%3 == 2 && len(ref) > 0 {
+			h1 = ref[rand.Intn(len(ref))]
+			idx.remove(h1)
+			j := sort.Search(len(ref), func(j int) bool { return ref[j] >= h1 })
+			ref = append(ref[:j], ref[j+1:]...)
+			continue
+		}
+
+		idx.add(h1)
+		j := sort.Search(len(ref), func(j int) bool { return ref[j] >= h1 })
+		ref = append(ref, 0)
+		copy(ref[j+1:], ref[j:])
+		ref[j] = h1
+	}
+	idx.add(math.MaxUint32)
+	ref = append(ref, math.MaxUint32)
+
+	for _, start := range []uint32{0, 1000, math.MaxUint32} {
+		var got []uint32
+		idx.seek(start, func(h1 uint32) bool {
+			got = append(got, h1)
+			return true
+		})
+
+		j := sort.Search(len(ref), func(j int) bool { return ref[j] >= start })
+		if fmt.Sprint(got) != fmt.Sprint(ref[j:]) {
+			t.Fatalf("seek %d: unexpected %d hashes, expected %d", start, len(got), len(ref)-j)
+		}
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	for _, c := range []struct {
+		pattern, s string
+		ok         bool
+	}{
+		{"*", "", true},
+		{"user:*", "user:1/2", true},
+		{"user:?", "user:12", false},
+		{"*:1*", "user:12", true},
+		{`a\*`, "a*", true},
+		{`a\*`, "ab", false},
+		{"abc", "ab", false},
+	} {
+		if matchGlob(c.pattern, c.s) != c.ok {
+			t.Fatalf("matchGlob(%q, %q) != %t", c.pattern, c.s, c.ok)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/pubgo/xcache"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// command arity和redis一致, 正数表示参数数量固定, 负数表示最少的参数数量, 都包含命令本身
+type command struct {
+	arity int
+	fn    func(s *Server, w *writer, args [][]byte)
+}
+
+var commands = map[string]command{
+	"get":     {2, (*Server).get},
+	"set":     {-3, (*Server).set},
+	"del":     {-2, (*Server).del},
+	"exists":  {-2, (*Server).exists},
+	"ttl":     {2, (*Server).ttl},
+	"pttl":    {2, (*Server).pttl},
+	"expire":  {3, (*Server).expire},
+	"persist": {2, (*Server).persist},
+	"mget":    {-2, (*Server).mget},
+	"mset":    {-3, (*Server).mset},
+	"incr":    {2, (*Server).incr},
+	"ping":    {-1, (*Server).ping},
+	"info":    {-1, (*Server).info},
+	"dbsize":  {1, (*Server).dbsize},
+	"command": {-1, (*Server).command},
+}
+
+// exec 执行一条命令, 返回是否需要关闭连接
+func (s *Server) exec(w *writer, args [][]byte) bool {
+	name := strings.ToLower(string(args[0]))
+	if name == "quit" {
+		w.WriteString("OK")
+		return true
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		w.WriteError(fmt.Sprintf("ERR unknown command '%s'", args[0]))
+		return false
+	}
+
+	if (cmd.arity > 0 && len(args) != cmd.arity) || (cmd.arity < 0 && len(args) < -cmd.arity) {
+		w.WriteError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", name))
+		return false
+	}
+
+	cmd.fn(s, w, args)
+	return false
+}
+
+var errNotInteger = errors.New("value is not an integer")
+
+// writeErr 把xcache的错误转换成redis风格的错误
+func writeErr(w *writer, err error) {
+	switch {
+	case errors.Is(err, xcache.ErrLength):
+		w.WriteError("ERR key or value length out of range")
+	case errors.Is(err, xcache.ErrExpiration):
+		w.WriteError("ERR invalid expire time")
+	case errors.Is(err, xcache.ErrBufExceeded), errors.Is(err, xcache.ErrAdmissionRejected):
+		w.WriteError("OOM command not allowed when used memory > 'maxmemory'")
+	default:
+		w.WriteError("ERR " + strings.SplitN(err.Error(), "\n", 2)[0])
+	}
+}
+
+func (s *Server) get(w *writer, args [][]byte) {
+	val, err := s.cache.Get(args[1])
+	switch {
+	case err == nil:
+		w.WriteBulk(val)
+	case errors.Is(err, xcache.ErrKeyNotFound):
+		w.WriteNull()
+	default:
+		writeErr(w, err)
+	}
+}
+
+// set SET key value [EX seconds|PX milliseconds], 没有EX和PX的时候永不过期, 过期时间不经过SnowSlideStrategy
+func (s *Server) set(w *writer, args [][]byte) {
+	var e = xcache.NoExpiration
+	for i := 3; i < len(args); i++ {
+		opt := strings.ToLower(string(args[i]))
+		if (opt != "ex" && opt != "px") || i+1 >= len(args) {
+			w.WriteError("ERR syntax error")
+			return
+		}
+
+		n, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+		if err != nil || n <= 0 {
+			w.WriteError("ERR invalid expire time in 'set' command")
+			return
+		}
+
+		e = time.Duration(n) * time.Millisecond
+		if opt == "ex" {
+			e = time.Duration(n) * time.Second
+		}
+		i++
+	}
+
+	if err := s.cache.SetWithOptions(args[1], args[2], xcache.SetOptions{TTL: e, Exact: true}); err != nil {
+		writeErr(w, err)
+		return
+	}
+	w.WriteString("OK")
+}
+
+func (s *Server) del(w *writer, args [][]byte) {
+	var n int64
+	for _, key := range args[1:] {
+		if err := s.cache.Delete(key); err == nil {
+			n++
+		}
+	}
+	w.WriteInt(n)
+}
+
+func (s *Server) exists(w *writer, args [][]byte) {
+	var n int64
+	for _, key := range args[1:] {
+		if _, err := s.cache.TTL(key); err == nil {
+			n++
+		}
+	}
+	w.WriteInt(n)
+}
+
+func (s *Server) ttl(w *writer, args [][]byte) {
+	s.writeTTL(w, args[1], time.Second)
+}
+
+func (s *Server) pttl(w *writer, args [][]byte) {
+	s.writeTTL(w, args[1], time.Millisecond)
+}
+
+// writeTTL key不存在返回-2, 永不过期返回-1, 和redis一样向上取整
+func (s *Server) writeTTL(w *writer, key []byte, unit time.Duration) {
+	ttl, err := s.cache.TTL(key)
+	switch {
+	case err != nil:
+		w.WriteInt(-2)
+	case ttl == xcache.NoExpiration:
+		w.WriteInt(-1)
+	default:
+		w.WriteInt(int64((ttl + unit - 1) / unit))
+	}
+}
+
+// persist PERSIST key, 去掉过期时间
+func (s *Server) persist(w *writer, args [][]byte) {
+	if ttl, err := s.cache.TTL(args[1]); err != nil || ttl == xcache.NoExpiration {
+		w.WriteInt(0)
+		return
+	}
+
+	if err := s.cache.Persist(args[1]); err != nil {
+		w.WriteInt(0)
+		return
+	}
+	w.WriteInt(1)
+}
+
+// expire EXPIRE key seconds, seconds小于等于0的时候删除key
+func (s *Server) expire(w *writer, args [][]byte) {
+	n, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		w.WriteError("ERR value is not an integer or out of range")
+		return
+	}
+
+	if n <= 0 {
+		if s.cache.Delete(args[1]) != nil {
+			w.WriteInt(0)
+			return
+		}
+		w.WriteInt(1)
+		return
+	}
+
+	err = s.cache.Expire(args[1], time.Duration(n)*time.Second)
+	switch {
+	case err == nil:
+		w.WriteInt(1)
+	case errors.Is(err, xcache.ErrKeyNotFound):
+		w.WriteInt(0)
+	default:
+		writeErr(w, err)
+	}
+}
+
+func (s *Server) mget(w *writer, args [][]byte) {
+	vals, errs := s.cache.MGet(args[1:])
+	w.WriteArray(len(vals))
+	for i := range vals {
+		if errs[i] != nil {
+			w.WriteNull()
+			continue
+		}
+		w.WriteBulk(vals[i])
+	}
+}
+
+func (s *Server) mset(w *writer, args [][]byte) {
+	if len(args)%2 != 1 {
+		w.WriteError("ERR wrong number of arguments for 'mset' command")
+		return
+	}
+
+	var keys = make([][]byte, 0, len(args)/2)
+	var vals = make([][]byte, 0, len(args)/2)
+	for i := 1; i < len(args); i += 2 {
+		keys = append(keys, args[i])
+		vals = append(vals, args[i+1])
+	}
+
+	for _, err := range s.cache.MSet(keys, vals, xcache.NoExpiration) {
+		if err != nil {
+			writeErr(w, err)
+			return
+		}
+	}
+	w.WriteString("OK")
+}
+
+// incr 数据以十进制字符串保存, 和redis一致, key存在的时候保留剩余的过期时间
+func (s *Server) incr(w *writer, args [][]byte) {
+	var key = args[1]
+	var n int64
+	for {
+		_, _, err := s.update(key, func(val []byte, _ xcache.Meta) ([]byte, error) {
+			var err error
+			if n, err = strconv.ParseInt(string(val), 10, 64); err != nil || n == 1<<63-1 {
+				return nil, errNotInteger
+			}
+			n++
+			return strconv.AppendInt(nil, n, 10), nil
+		})
+
+		if errors.Is(err, xcache.ErrKeyNotFound) {
+			n = 1
+			var added bool
+			if added, _, err = s.add(key, []byte("1"), xcache.NoExpiration, 0); err == nil && !added {
+				// 其他连接已经写入, 重新读取
+				continue
+			}
+		}
+
+		switch {
+		case err == errNotInteger:
+			w.WriteError("ERR value is not an integer or out of range")
+		case err != nil:
+			writeErr(w, err)
+		default:
+			w.WriteInt(n)
+		}
+		return
+	}
+}
+
+func (s *Server) ping(w *writer, args [][]byte) {
+	switch len(args) {
+	case 1:
+		w.WriteString("PONG")
+	case 2:
+		w.WriteBulk(args[1])
+	default:
+		w.WriteError("ERR wrong number of arguments for 'ping' command")
+	}
+}
+
+func (s *Server) info(w *writer, _ [][]byte) {
+	opts := s.cache.Option()
+
+	var buf bytes.Buffer
+	buf.WriteString("# Server\r\n")
+	// 部分客户端会根据redis_version判断支持的命令, 按照RESP2对应的版本返回
+	buf.WriteString("redis_version:2.8.0\r\n")
+	buf.WriteString("server:xcache\r\n")
+	fmt.Fprintf(&buf, "go_version:%s\r\n", runtime.Version())
+	fmt.Fprintf(&buf, "uptime_in_seconds:%d\r\n", int64(time.Since(s.startAt)/time.Second))
+	buf.WriteString("\r\n# Memory\r\n")
+	fmt.Fprintf(&buf, "used_memory:%d\r\n", s.cache.Size())
+	fmt.Fprintf(&buf, "maxmemory:%d\r\n", opts.MaxBufSize)
+	st := s.cache.Stats()
+	buf.WriteString("\r\n# Stats\r\n")
+	fmt.Fprintf(&buf, "keyspace_hits:%d\r\n", st.Hits)
+	fmt.Fprintf(&buf, "keyspace_misses:%d\r\n", st.Misses)
+	fmt.Fprintf(&buf, "expired_keys:%d\r\n", st.LazyExpirations+st.JanitorExpirations)
+	fmt.Fprintf(&buf, "evicted_keys:%d\r\n", st.Evictions)
+	buf.WriteString("\r\n# Keyspace\r\n")
+	fmt.Fprintf(&buf, "db0:keys=%d,shards=%d\r\n", s.cache.Count(), opts.ShardCount)
+	w.WriteBulk(buf.Bytes())
+}
+
+func (s *Server) dbsize(w *writer, _ [][]byte) {
+	w.WriteInt(int64(s.cache.Count()))
+}
+
+// command redis-cli启动的时候会发送COMMAND DOCS, 返回空数组
+func (s *Server) command(w *writer, _ [][]byte) {
+	w.WriteArray(0)
+}
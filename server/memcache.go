@@ -0,0 +1,475 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/pubgo/xcache"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// memcached的exptime大于30天的时候是unix时间戳
+const mcRelativeExpiration = 60 * 60 * 24 * 30
+
+var (
+	errBadFormat = errors.New("CLIENT_ERROR bad command line format")
+	errBadChunk  = errors.New("CLIENT_ERROR bad data chunk")
+)
+
+// mcConn memcached连接, noreply的时候不写入响应
+type mcConn struct {
+	r       *reader
+	w       *writer
+	noreply bool
+}
+
+func (c *mcConn) reply(line string) {
+	if c.noreply {
+		return
+	}
+	c.w.w.WriteString(line)
+	c.w.w.Write(crlf)
+}
+
+// readData 读取数据块, 数据块必须以\r\n结尾
+func (c *mcConn) readData(n int) ([]byte, error) {
+	if n < 0 || n > maxBulkLen {
+		return nil, errBadChunk
+	}
+
+	var buf = make([]byte, n+2)
+	if _, err := io.ReadFull(c.r.r, buf); err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(buf[n:], crlf) {
+		return nil, errBadChunk
+	}
+	return buf[:n], nil
+}
+
+// mcCommand 返回错误的时候关闭连接
+type mcCommand func(s *Server, c *mcConn, args [][]byte) error
+
+var mcCommands = map[string]mcCommand{
+	"get":       (*Server).mcGet,
+	"gets":      (*Server).mcGet,
+	"set":       (*Server).mcStore,
+	"add":       (*Server).mcStore,
+	"replace":   (*Server).mcStore,
+	"append":    (*Server).mcStore,
+	"prepend":   (*Server).mcStore,
+	"cas":       (*Server).mcStore,
+	"delete":    (*Server).mcDelete,
+	"incr":      (*Server).mcIncr,
+	"decr":      (*Server).mcIncr,
+	"touch":     (*Server).mcTouch,
+	"flush_all": (*Server).mcFlushAll,
+	"stats":     (*Server).mcStats,
+	"version":   (*Server).mcVersion,
+	"verbosity": (*Server).mcVerbosity,
+	"mg":        (*Server).mgCommand,
+	"ms":        (*Server).msCommand,
+	"md":        (*Server).mdCommand,
+	"ma":        (*Server).maCommand,
+	"mn":        (*Server).mnCommand,
+}
+
+func (s *Server) serveMemcacheConn(conn net.Conn) {
+	defer s.untrack(conn)
+	defer conn.Close()
+
+	c := &mcConn{r: newReader(conn), w: newWriter(conn)}
+
+	// 命令处理中的panic只关闭当前连接, 不影响其他连接
+	defer func() {
+		if err := recover(); err != nil {
+			c.noreply = false
+			c.reply(fmt.Sprintf("SERVER_ERROR %v", err))
+			_ = c.w.Flush()
+		}
+	}()
+
+	for {
+		line, err := c.r.readLine()
+		if err != nil {
+			if err == errProtocol {
+				c.noreply = false
+				c.reply(errBadFormat.Error())
+				_ = c.w.Flush()
+			}
+			return
+		}
+
+		args := bytes.Fields(line)
+		if len(args) == 0 {
+			continue
+		}
+
+		name := string(args[0])
+		if name == "quit" {
+			_ = c.w.Flush()
+			return
+		}
+
+		c.noreply = false
+		cmd, ok := mcCommands[name]
+		if !ok {
+			c.reply("ERROR")
+		} else if err := cmd(s, c, args); err != nil {
+			c.noreply = false
+			if err == errBadChunk || err == errBadFormat {
+				c.reply(err.Error())
+				_ = c.w.Flush()
+			}
+			return
+		}
+
+		// pipeline中的命令处理完之后再flush
+		if c.r.Buffered() == 0 {
+			if err := c.w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// mcNoreply 最后一个参数是noreply的时候不写入响应
+func mcNoreply(c *mcConn, args [][]byte) [][]byte {
+	if n := len(args); n > 0 && string(args[n-1]) == "noreply" {
+		c.noreply = true
+		return args[:n-1]
+	}
+	return args
+}
+
+// mcExpiration 转换memcached的exptime, 0表示永不过期, 返回false表示数据已经过期
+func (s *Server) mcExpiration(exptime int64) (time.Duration, bool) {
+	switch {
+	case exptime == 0:
+		return xcache.NoExpiration, true
+	case exptime < 0:
+		return 0, false
+	case exptime > mcRelativeExpiration:
+		e := time.Until(time.Unix(exptime, 0))
+		return e, e > 0
+	default:
+		return time.Duration(exptime) * time.Second, true
+	}
+}
+
+// mcError 把xcache的错误转换成memcached的错误
+func mcError(c *mcConn, err error) {
+	switch {
+	case errors.Is(err, xcache.ErrLength):
+		c.reply("CLIENT_ERROR key or value length out of range")
+	case errors.Is(err, xcache.ErrExpiration):
+		c.reply("CLIENT_ERROR invalid exptime argument")
+	case errors.Is(err, xcache.ErrBufExceeded), errors.Is(err, xcache.ErrAdmissionRejected):
+		c.reply("SERVER_ERROR out of memory storing object")
+	default:
+		c.reply("SERVER_ERROR " + string(bytes.SplitN([]byte(err.Error()), []byte("\n"), 2)[0]))
+	}
+}
+
+// mcGet get <key>*, gets <key>*
+func (s *Server) mcGet(c *mcConn, args [][]byte) error {
+	if len(args) < 2 {
+		c.reply("ERROR")
+		return nil
+	}
+
+	var withCAS = string(args[0]) == "gets"
+	var buf []byte
+	for _, key := range args[1:] {
+		val, meta, err := s.cache.GetWithMeta(key)
+		if err != nil {
+			continue
+		}
+
+		buf = append(buf[:0], "VALUE "...)
+		buf = append(buf, key...)
+		buf = append(buf, ' ')
+		buf = strconv.AppendUint(buf, uint64(meta.Flags), 10)
+		buf = append(buf, ' ')
+		buf = strconv.AppendInt(buf, int64(len(val)), 10)
+		if withCAS {
+			buf = append(buf, ' ')
+			buf = strconv.AppendUint(buf, meta.CAS, 10)
+		}
+		buf = append(buf, crlf...)
+		buf = append(buf, val...)
+		buf = append(buf, crlf...)
+		c.w.w.Write(buf)
+	}
+	c.reply("END")
+	return nil
+}
+
+// mcStore <command> <key> <flags> <exptime> <bytes> [noreply]
+// cas <key> <flags> <exptime> <bytes> <cas unique> [noreply]
+func (s *Server) mcStore(c *mcConn, args [][]byte) error {
+	args = mcNoreply(c, args)
+
+	var name = string(args[0])
+	var argc = 5
+	if name == "cas" {
+		argc = 6
+	}
+	if len(args) != argc {
+		return errBadFormat
+	}
+
+	flags, err1 := strconv.ParseUint(string(args[2]), 10, 32)
+	exptime, err2 := strconv.ParseInt(string(args[3]), 10, 64)
+	n, err3 := strconv.Atoi(string(args[4]))
+	if err1 != nil || err2 != nil || err3 != nil {
+		return errBadFormat
+	}
+
+	var cas uint64
+	if name == "cas" {
+		var err error
+		if cas, err = strconv.ParseUint(string(args[5]), 10, 64); err != nil {
+			return errBadFormat
+		}
+	}
+
+	val, err := c.readData(n)
+	if err != nil {
+		return err
+	}
+
+	key := args[1]
+	e, ok := s.mcExpiration(exptime)
+	if !ok {
+		// 已经过期的数据相当于删除
+		_ = s.cache.Delete(key)
+		c.reply("STORED")
+		return nil
+	}
+
+	var stored bool
+	switch name {
+	case "set":
+		_, err = s.store(key, val, e, xcache.Meta{Flags: uint32(flags)})
+		stored = err == nil
+	case "add":
+		stored, _, err = s.add(key, val, e, uint32(flags))
+	case "cas":
+		if cas == 0 {
+			// cas从1开始分配, 0不会匹配任何数据
+			if _, _, err = s.cache.GetWithMeta(key); err == nil {
+				err = xcache.ErrCASMismatch
+			}
+		} else {
+			_, err = s.store(key, val, e, xcache.Meta{Flags: uint32(flags), CAS: cas})
+		}
+		stored = err == nil
+		if errors.Is(err, xcache.ErrCASMismatch) {
+			c.reply("EXISTS")
+			return nil
+		}
+	case "replace":
+		_, err = s.replace(key, val, e, uint32(flags))
+		stored = err == nil
+	case "append", "prepend":
+		_, _, err = s.update(key, func(old []byte, _ xcache.Meta) ([]byte, error) {
+			if name == "append" {
+				return append(append(make([]byte, 0, len(old)+len(val)), old...), val...), nil
+			}
+			return append(append(make([]byte, 0, len(old)+len(val)), val...), old...), nil
+		})
+		stored = err == nil
+	}
+
+	switch {
+	case stored:
+		c.reply("STORED")
+	case err == nil:
+		c.reply("NOT_STORED")
+	case errors.Is(err, xcache.ErrKeyNotFound):
+		if name == "cas" {
+			c.reply("NOT_FOUND")
+		} else {
+			c.reply("NOT_STORED")
+		}
+	default:
+		mcError(c, err)
+	}
+	return nil
+}
+
+// mcDelete delete <key> [noreply]
+func (s *Server) mcDelete(c *mcConn, args [][]byte) error {
+	args = mcNoreply(c, args)
+	if len(args) != 2 {
+		return errBadFormat
+	}
+
+	if err := s.cache.Delete(args[1]); err != nil {
+		c.reply("NOT_FOUND")
+		return nil
+	}
+	c.reply("DELETED")
+	return nil
+}
+
+// mcIncr incr <key> <value> [noreply], decr <key> <value> [noreply]
+func (s *Server) mcIncr(c *mcConn, args [][]byte) error {
+	args = mcNoreply(c, args)
+	if len(args) != 3 {
+		return errBadFormat
+	}
+
+	delta, err := strconv.ParseUint(string(args[2]), 10, 64)
+	if err != nil {
+		c.reply("CLIENT_ERROR invalid numeric delta argument")
+		return nil
+	}
+
+	val, _, err := s.update(args[1], func(val []byte, _ xcache.Meta) ([]byte, error) {
+		return incrValue(val, delta, string(args[0]) == "incr")
+	})
+
+	switch {
+	case err == nil:
+		c.reply(string(val))
+	case err == errNotInteger:
+		c.reply("CLIENT_ERROR cannot increment or decrement non-numeric value")
+	case errors.Is(err, xcache.ErrKeyNotFound):
+		c.reply("NOT_FOUND")
+	default:
+		mcError(c, err)
+	}
+	return nil
+}
+
+// incrValue 和memcached一致, 数据是64位无符号整数, incr溢出的时候回绕, decr最小为0
+func incrValue(val []byte, delta uint64, incr bool) ([]byte, error) {
+	n, err := strconv.ParseUint(string(bytes.TrimSpace(val)), 10, 64)
+	if err != nil {
+		return nil, errNotInteger
+	}
+
+	switch {
+	case incr:
+		n += delta
+	case delta > n:
+		n = 0
+	default:
+		n -= delta
+	}
+	return strconv.AppendUint(nil, n, 10), nil
+}
+
+// mcTouch touch <key> <exptime> [noreply]
+func (s *Server) mcTouch(c *mcConn, args [][]byte) error {
+	args = mcNoreply(c, args)
+	if len(args) != 3 {
+		return errBadFormat
+	}
+
+	exptime, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return errBadFormat
+	}
+
+	if err = s.touch(args[1], exptime); err != nil {
+		if errors.Is(err, xcache.ErrKeyNotFound) {
+			c.reply("NOT_FOUND")
+			return nil
+		}
+		mcError(c, err)
+		return nil
+	}
+	c.reply("TOUCHED")
+	return nil
+}
+
+// touch 修改过期时间, 已经过期的exptime删除数据
+func (s *Server) touch(key []byte, exptime int64) error {
+	e, ok := s.mcExpiration(exptime)
+	if !ok {
+		return s.cache.Delete(key)
+	}
+	return s.cache.Touch(key, e)
+}
+
+// mcFlushAll flush_all [delay] [noreply]
+func (s *Server) mcFlushAll(c *mcConn, args [][]byte) error {
+	args = mcNoreply(c, args)
+	if len(args) > 2 {
+		return errBadFormat
+	}
+
+	var delay int64
+	if len(args) == 2 {
+		var err error
+		if delay, err = strconv.ParseInt(string(args[1]), 10, 64); err != nil || delay < 0 {
+			return errBadFormat
+		}
+	}
+
+	if delay == 0 {
+		_ = s.cache.Flush()
+	} else {
+		time.AfterFunc(time.Duration(delay)*time.Second, func() {
+			_ = s.cache.Flush()
+		})
+	}
+	c.reply("OK")
+	return nil
+}
+
+func (s *Server) mcStats(c *mcConn, args [][]byte) error {
+	if len(args) > 1 {
+		// 不支持stats子命令, 和memcached一样返回空的统计
+		c.reply("END")
+		return nil
+	}
+
+	s.mu.Lock()
+	conns := len(s.conns)
+	s.mu.Unlock()
+
+	opts := s.cache.Option()
+	st := s.cache.Stats()
+	for _, stat := range [][2]interface{}{
+		{"pid", os.Getpid()},
+		{"uptime", int64(time.Since(s.startAt) / time.Second)},
+		{"time", time.Now().Unix()},
+		{"version", mcServerVersion},
+		{"curr_connections", conns},
+		{"curr_items", s.cache.Count()},
+		{"bytes", s.cache.Size()},
+		{"limit_maxbytes", opts.MaxBufSize},
+		{"shards", opts.ShardCount},
+		{"get_hits", st.Hits},
+		{"get_misses", st.Misses},
+		{"cmd_set", st.Sets},
+		{"delete_hits", st.Deletes},
+		{"evictions", st.Evictions},
+	} {
+		c.reply(fmt.Sprintf("STAT %s %v", stat[0], stat[1]))
+	}
+	c.reply("END")
+	return nil
+}
+
+const mcServerVersion = "1.6.0-xcache"
+
+func (s *Server) mcVersion(c *mcConn, _ [][]byte) error {
+	c.reply("VERSION " + mcServerVersion)
+	return nil
+}
+
+func (s *Server) mcVerbosity(c *mcConn, args [][]byte) error {
+	mcNoreply(c, args)
+	c.reply("OK")
+	return nil
+}
@@ -0,0 +1,415 @@
+package server
+
+import (
+	"encoding/base64"
+	"errors"
+	"github.com/pubgo/xcache"
+	"strconv"
+)
+
+var (
+	errInvalidFlag = errors.New("CLIENT_ERROR invalid flag")
+	errMetaExists  = errors.New("cas mismatch")
+)
+
+// metaFlag meta命令的flag, 一个字符加上可选的参数
+type metaFlag struct {
+	c   byte
+	tok []byte
+}
+
+// metaReq meta命令的请求
+type metaReq struct {
+	key    []byte
+	rawKey []byte
+	flags  []metaFlag
+}
+
+// parseMeta 解析key和flags, allowed是命令支持的flags
+func parseMeta(key []byte, args [][]byte, allowed string) (*metaReq, error) {
+	var m = &metaReq{key: key, rawKey: key}
+	for _, arg := range args {
+		if len(arg) == 0 || !containsByte(allowed, arg[0]) {
+			return nil, errInvalidFlag
+		}
+		m.flags = append(m.flags, metaFlag{c: arg[0], tok: arg[1:]})
+	}
+
+	// b表示key是base64编码的
+	if m.has('b') {
+		key, err := base64.StdEncoding.DecodeString(string(key))
+		if err != nil {
+			return nil, errBadFormat
+		}
+		m.key = key
+	}
+	return m, nil
+}
+
+func containsByte(s string, c byte) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] == c {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *metaReq) has(c byte) bool {
+	_, ok := m.get(c)
+	return ok
+}
+
+func (m *metaReq) get(c byte) ([]byte, bool) {
+	for _, f := range m.flags {
+		if f.c == c {
+			return f.tok, true
+		}
+	}
+	return nil, false
+}
+
+// int flag c的参数, 没有flag c的时候返回def
+func (m *metaReq) int(c byte, def int64) (int64, error) {
+	tok, ok := m.get(c)
+	if !ok {
+		return def, nil
+	}
+
+	n, err := strconv.ParseInt(string(tok), 10, 64)
+	if err != nil {
+		return 0, errInvalidFlag
+	}
+	return n, nil
+}
+
+// uint flag c的参数, 没有flag c的时候返回def
+func (m *metaReq) uint(c byte, def uint64) (uint64, error) {
+	tok, ok := m.get(c)
+	if !ok {
+		return def, nil
+	}
+
+	n, err := strconv.ParseUint(string(tok), 10, 64)
+	if err != nil {
+		return 0, errInvalidFlag
+	}
+	return n, nil
+}
+
+// appendRet 按照请求的顺序添加需要返回的flags
+func (s *Server) appendRet(buf []byte, m *metaReq, val []byte, meta xcache.Meta) []byte {
+	for _, f := range m.flags {
+		switch f.c {
+		case 'b':
+			if m.has('k') {
+				buf = append(buf, " b"...)
+			}
+		case 'c':
+			buf = append(buf, " c"...)
+			buf = strconv.AppendUint(buf, meta.CAS, 10)
+		case 'f':
+			buf = append(buf, " f"...)
+			buf = strconv.AppendUint(buf, uint64(meta.Flags), 10)
+		case 'k':
+			buf = append(buf, " k"...)
+			buf = append(buf, m.rawKey...)
+		case 'O':
+			buf = append(buf, " O"...)
+			buf = append(buf, f.tok...)
+		case 's':
+			buf = append(buf, " s"...)
+			buf = strconv.AppendInt(buf, int64(len(val)), 10)
+		case 't':
+			buf = append(buf, " t"...)
+			var ttl int64 = -1
+			if d, err := s.cache.TTL(m.key); err == nil && d != xcache.NoExpiration {
+				ttl = int64((d + 999999999) / 1000000000)
+			}
+			buf = strconv.AppendInt(buf, ttl, 10)
+		}
+	}
+	return buf
+}
+
+// metaReply 写入HD或者VA响应, quiet的时候不写入HD
+func (s *Server) metaReply(c *mcConn, m *metaReq, val []byte, meta xcache.Meta, withValue bool) {
+	var buf []byte
+	if withValue {
+		buf = append(buf, "VA "...)
+		buf = strconv.AppendInt(buf, int64(len(val)), 10)
+	} else {
+		if m.has('q') {
+			return
+		}
+		buf = append(buf, "HD"...)
+	}
+
+	buf = s.appendRet(buf, m, val, meta)
+	buf = append(buf, crlf...)
+	if withValue {
+		buf = append(buf, val...)
+		buf = append(buf, crlf...)
+	}
+	c.w.w.Write(buf)
+}
+
+// metaMiss 写入EN, NF, NS或者EX, quiet的时候不写入EN和NF
+func metaMiss(c *mcConn, m *metaReq, code string) {
+	if m.has('q') && (code == "EN" || code == "NF") {
+		return
+	}
+
+	var buf = []byte(code)
+	if tok, ok := m.get('O'); ok {
+		buf = append(append(buf, " O"...), tok...)
+	}
+	if m.has('k') {
+		buf = append(append(buf, " k"...), m.rawKey...)
+	}
+	c.reply(string(buf))
+}
+
+// mgCommand mg <key> <flags>*
+func (s *Server) mgCommand(c *mcConn, args [][]byte) error {
+	if len(args) < 2 {
+		c.reply(errBadFormat.Error())
+		return nil
+	}
+
+	m, err := parseMeta(args[1], args[2:], "bcfkOqstTv")
+	if err != nil {
+		c.reply(err.Error())
+		return nil
+	}
+
+	val, meta, err := s.cache.GetWithMeta(m.key)
+	if err != nil {
+		if errors.Is(err, xcache.ErrKeyNotFound) {
+			metaMiss(c, m, "EN")
+			return nil
+		}
+		mcError(c, err)
+		return nil
+	}
+
+	if _, ok := m.get('T'); ok {
+		exptime, err := m.int('T', 0)
+		if err != nil {
+			c.reply(err.Error())
+			return nil
+		}
+
+		if err := s.touch(m.key, exptime); err != nil {
+			mcError(c, err)
+			return nil
+		}
+	}
+
+	s.metaReply(c, m, val, meta, m.has('v'))
+	return nil
+}
+
+// msCommand ms <key> <datalen> <flags>*
+// M: S(set, 默认), E(add), A(append), P(prepend), R(replace), C只支持S模式
+func (s *Server) msCommand(c *mcConn, args [][]byte) error {
+	if len(args) < 3 {
+		return errBadFormat
+	}
+
+	n, err := strconv.Atoi(string(args[2]))
+	if err != nil {
+		return errBadFormat
+	}
+
+	val, err := c.readData(n)
+	if err != nil {
+		return err
+	}
+
+	m, err := parseMeta(args[1], args[3:], "bcCFkOqTM")
+	if err != nil {
+		c.reply(err.Error())
+		return nil
+	}
+
+	cas, err1 := m.uint('C', 0)
+	flags, err2 := m.uint('F', 0)
+	exptime, err3 := m.int('T', 0)
+	mode, _ := m.get('M')
+	if err1 != nil || err2 != nil || err3 != nil || flags > 1<<32-1 || len(mode) > 1 || (cas != 0 && len(mode) == 1 && mode[0] != 'S') {
+		c.reply(errInvalidFlag.Error())
+		return nil
+	}
+
+	e, ok := s.mcExpiration(exptime)
+	if !ok {
+		// 已经过期的数据相当于删除
+		_ = s.cache.Delete(m.key)
+		s.metaReply(c, m, val, xcache.Meta{}, false)
+		return nil
+	}
+
+	var meta = xcache.Meta{Flags: uint32(flags)}
+	var stored bool
+	if len(mode) == 0 {
+		mode = []byte{'S'}
+	}
+
+	switch mode[0] {
+	case 'S', 's':
+		meta.CAS, err = s.store(m.key, val, e, xcache.Meta{Flags: uint32(flags), CAS: cas})
+		stored = err == nil
+	case 'E', 'e':
+		stored, meta.CAS, err = s.add(m.key, val, e, uint32(flags))
+	case 'R', 'r':
+		meta.CAS, err = s.replace(m.key, val, e, uint32(flags))
+		stored = err == nil
+	case 'A', 'a', 'P', 'p':
+		var appendMode = mode[0] == 'A' || mode[0] == 'a'
+		_, meta, err = s.update(m.key, func(old []byte, _ xcache.Meta) ([]byte, error) {
+			if appendMode {
+				return append(append(make([]byte, 0, len(old)+len(val)), old...), val...), nil
+			}
+			return append(append(make([]byte, 0, len(old)+len(val)), val...), old...), nil
+		})
+		stored = err == nil
+	default:
+		c.reply(errInvalidFlag.Error())
+		return nil
+	}
+
+	switch {
+	case stored:
+		s.metaReply(c, m, val, meta, false)
+	case errors.Is(err, xcache.ErrCASMismatch):
+		metaMiss(c, m, "EX")
+	case errors.Is(err, xcache.ErrKeyNotFound) && cas != 0:
+		metaMiss(c, m, "NF")
+	case err == nil, errors.Is(err, xcache.ErrKeyNotFound):
+		metaMiss(c, m, "NS")
+	default:
+		mcError(c, err)
+	}
+	return nil
+}
+
+// mdCommand md <key> <flags>*
+// C比较cas和删除是原子的
+func (s *Server) mdCommand(c *mcConn, args [][]byte) error {
+	if len(args) < 2 {
+		c.reply(errBadFormat.Error())
+		return nil
+	}
+
+	m, err := parseMeta(args[1], args[2:], "bCkOq")
+	if err != nil {
+		c.reply(err.Error())
+		return nil
+	}
+
+	cas, err := m.uint('C', 0)
+	if err != nil {
+		c.reply(err.Error())
+		return nil
+	}
+
+	if cas != 0 {
+		err = s.cache.DeleteWithCAS(m.key, cas)
+	} else {
+		err = s.cache.Delete(m.key)
+	}
+
+	switch {
+	case errors.Is(err, xcache.ErrCASMismatch):
+		metaMiss(c, m, "EX")
+		return nil
+	case err != nil:
+		metaMiss(c, m, "NF")
+		return nil
+	}
+	s.metaReply(c, m, nil, xcache.Meta{}, false)
+	return nil
+}
+
+// maCommand ma <key> <flags>*
+// M: I(incr, 默认), D(decr); D: delta, 默认1; N: key不存在的时候用J初始化, N是过期时间
+func (s *Server) maCommand(c *mcConn, args [][]byte) error {
+	if len(args) < 2 {
+		c.reply(errBadFormat.Error())
+		return nil
+	}
+
+	m, err := parseMeta(args[1], args[2:], "bcCNJDTMqOktv")
+	if err != nil {
+		c.reply(err.Error())
+		return nil
+	}
+
+	cas, err1 := m.uint('C', 0)
+	delta, err2 := m.uint('D', 1)
+	initial, err3 := m.uint('J', 0)
+	exptime, err4 := m.int('T', 0)
+	vivify, err5 := m.int('N', 0)
+	mode, _ := m.get('M')
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil || err5 != nil || len(mode) > 1 {
+		c.reply(errInvalidFlag.Error())
+		return nil
+	}
+
+	var incr = true
+	if len(mode) == 1 {
+		switch mode[0] {
+		case 'I', 'i', '+':
+		case 'D', 'd', '-':
+			incr = false
+		default:
+			c.reply(errInvalidFlag.Error())
+			return nil
+		}
+	}
+
+	for {
+		val, meta, err := s.update(m.key, func(val []byte, meta xcache.Meta) ([]byte, error) {
+			if cas != 0 && meta.CAS != cas {
+				return nil, errMetaExists
+			}
+			return incrValue(val, delta, incr)
+		})
+
+		if errors.Is(err, xcache.ErrKeyNotFound) && m.has('N') {
+			e, _ := s.mcExpiration(vivify)
+			val = strconv.AppendUint(nil, initial, 10)
+
+			var added bool
+			if added, meta.CAS, err = s.add(m.key, val, e, 0); err == nil && !added {
+				// 其他连接已经写入, 重新计算
+				continue
+			}
+		}
+
+		if err == nil && m.has('T') {
+			err = s.touch(m.key, exptime)
+		}
+
+		switch {
+		case err == nil:
+			s.metaReply(c, m, val, meta, m.has('v'))
+		case err == errMetaExists:
+			metaMiss(c, m, "EX")
+		case err == errNotInteger:
+			c.reply("CLIENT_ERROR cannot increment or decrement non-numeric value")
+		case errors.Is(err, xcache.ErrKeyNotFound):
+			metaMiss(c, m, "NF")
+		default:
+			mcError(c, err)
+		}
+		return nil
+	}
+}
+
+// mnCommand pipeline结束的标记
+func (s *Server) mnCommand(c *mcConn, _ [][]byte) error {
+	c.reply("MN")
+	return nil
+}
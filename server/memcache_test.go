@@ -0,0 +1,171 @@
+package server
+
+import (
+	"bufio"
+	"github.com/pubgo/xcache"
+	"github.com/pubgo/xerror"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mcClient 测试用的memcached客户端, 按行比较响应
+type mcClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func newMemcacheServer(t *testing.T) (*Server, *mcClient) {
+	cache, err := xcache.New(CacheOptions(time.Millisecond, 0)...)
+	xerror.Panic(err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	xerror.Panic(err)
+
+	srv := New(cache)
+	go srv.ServeMemcache(ln)
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	xerror.Panic(err)
+	return srv, &mcClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+// do 发送请求, 依次比较响应的每一行
+func (c *mcClient) do(req string, lines ...string) {
+	c.t.Helper()
+	_, err := c.conn.Write([]byte(req))
+	xerror.Panic(err)
+
+	for _, expected := range lines {
+		line, err := c.r.ReadString('\n')
+		xerror.Panic(err)
+		if got := strings.TrimRight(line, "\r\n"); got != expected {
+			c.t.Fatalf("%q: expected %q, got %q", req, expected, got)
+		}
+	}
+}
+
+// field 发送请求, 返回第一行响应的第n个字段
+func (c *mcClient) field(req string, n int) string {
+	c.t.Helper()
+	_, err := c.conn.Write([]byte(req))
+	xerror.Panic(err)
+
+	line, err := c.r.ReadString('\n')
+	xerror.Panic(err)
+	return strings.Fields(line)[n]
+}
+
+func TestMemcache(t *testing.T) {
+	srv, c := newMemcacheServer(t)
+	defer srv.Close()
+
+	c.do("get mc_key_a\r\n", "END")
+	c.do("set mc_key_a 5 0 5\r\nhello\r\n", "STORED")
+	c.do("get mc_key_a mc_key_b\r\n", "VALUE mc_key_a 5 5", "hello", "END")
+	c.do("add mc_key_a 0 0 1\r\nx\r\n", "NOT_STORED")
+	c.do("add mc_key_b 0 0 1\r\nx\r\n", "STORED")
+	c.do("replace mc_key_c 0 0 1\r\nx\r\n", "NOT_STORED")
+	c.do("replace mc_key_b 7 0 1\r\ny\r\n", "STORED")
+	c.do("append mc_key_a 0 0 6\r\n world\r\n", "STORED")
+	c.do("prepend mc_key_a 0 0 1\r\n>\r\n", "STORED")
+	c.do("get mc_key_a mc_key_b\r\n", "VALUE mc_key_a 5 12", ">hello world", "VALUE mc_key_b 7 1", "y", "END")
+
+	// cas
+	cas := c.field("gets mc_key_a\r\n", 4)
+	c.do("", ">hello world", "END")
+	c.do("cas mc_key_a 0 0 3 "+cas+"\r\nnew\r\n", "STORED")
+	c.do("cas mc_key_a 0 0 3 "+cas+"\r\nold\r\n", "EXISTS")
+	c.do("cas mc_key_c 0 0 3 "+cas+"\r\nold\r\n", "NOT_FOUND")
+
+	// incr, decr
+	c.do("set mc_key_n 0 0 2\r\n10\r\n", "STORED")
+	c.do("incr mc_key_n 5\r\n", "15")
+	c.do("decr mc_key_n 20\r\n", "0")
+	c.do("incr mc_key_c 1\r\n", "NOT_FOUND")
+	c.do("incr mc_key_a 1\r\n", "CLIENT_ERROR cannot increment or decrement non-numeric value")
+
+	c.do("touch mc_key_n 10\r\n", "TOUCHED")
+	c.do("touch mc_key_c 10\r\n", "NOT_FOUND")
+	c.do("delete mc_key_n\r\n", "DELETED")
+	c.do("delete mc_key_n\r\n", "NOT_FOUND")
+	c.do("delete mc_key_b noreply\r\nget mc_key_b\r\n", "END")
+	c.do("set a 0 0 1\r\nx\r\n", "STORED")
+	c.do("incr foo 1\r\n", "NOT_FOUND")
+	c.do("touch foo 10\r\n", "NOT_FOUND")
+
+	// 精确的过期时间, append和incr保留原来的过期时间
+	c.do("set mc_key_c 0 3600 1\r\n1\r\n", "STORED")
+	c.do("mg mc_key_c t\r\n", "HD t3600")
+	c.do("append mc_key_c 0 0 1\r\n0\r\n", "STORED")
+	c.do("incr mc_key_c 1\r\n", "11")
+	c.do("mg mc_key_c t\r\n", "HD t3600")
+	c.do("set mc_key_c 0 1 1\r\n1\r\n", "STORED")
+	c.do("incr mc_key_c 1\r\n", "2")
+	c.do("mg mc_key_c t\r\n", "HD t1")
+	c.do("bogus\r\n", "ERROR")
+	c.do("version\r\n", "VERSION "+mcServerVersion)
+
+	c.do("flush_all\r\n", "OK")
+	c.do("get mc_key_a\r\n", "END")
+	if items := c.field("stats\r\n", 2); items == "" {
+		t.Fatal("expected stats")
+	}
+}
+
+func TestMemcacheMeta(t *testing.T) {
+	srv, c := newMemcacheServer(t)
+	defer srv.Close()
+
+	c.do("mn\r\n", "MN")
+	c.do("mg mc_key_a v\r\n", "EN")
+	c.do("mg mc_key_a v q\r\nmn\r\n", "MN")
+	c.do("ms mc_key_a 5 F3 T10\r\nhello\r\n", "HD")
+	c.do("mg mc_key_a s v f k Oabc\r\n", "VA 5 s5 f3 kmc_key_a Oabc", "hello")
+	c.do("mg mc_key_a t\r\n", "HD t10")
+	c.do("mg mc_key_a T20 t\r\n", "HD t20")
+	c.do("ms mc_key_a 1 ME\r\nx\r\n", "NS")
+	c.do("ms mc_key_a 1 MA\r\n!\r\n", "HD")
+	c.do("mg mc_key_a v\r\n", "VA 6", "hello!")
+
+	cas := c.field("mg mc_key_a c\r\n", 1)
+	c.do("ms mc_key_a 1 C1\r\nx\r\n", "EX")
+	c.do("ms mc_key_a 1 "+strings.Replace(cas, "c", "C", 1)+"\r\nx\r\n", "HD")
+
+	// base64编码的key
+	c.do("mg bWNfa2V5X2E= b v k\r\n", "VA 1 b kbWNfa2V5X2E=", "x")
+
+	c.do("ma mc_key_n\r\n", "NF")
+	c.do("ma mc_key_n N10 J5 v\r\n", "VA 1", "5")
+	c.do("ma mc_key_n D10 v\r\n", "VA 2", "15")
+	c.do("ma mc_key_n MD D20 v\r\n", "VA 1", "0")
+
+	c.do("md mc_key_n C1\r\n", "EX")
+	cas = c.field("mg mc_key_n c\r\n", 1)
+	c.do("md mc_key_n "+strings.Replace(cas, "c", "C", 1)+"\r\n", "HD")
+	c.do("md mc_key_n "+strings.Replace(cas, "c", "C", 1)+"\r\n", "NF")
+	c.do("ma mc_key_n N0 J1 v\r\n", "VA 1", "1")
+	c.do("md mc_key_n q\r\nmd mc_key_n\r\n", "NF")
+	c.do("mg mc_key_a x\r\n", "CLIENT_ERROR invalid flag")
+}
+
+func TestMemcacheWithRESP(t *testing.T) {
+	srv, c := newMemcacheServer(t)
+	defer srv.Close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	xerror.Panic(err)
+	go srv.Serve(ln)
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	xerror.Panic(err)
+	rc := &client{t: t, conn: conn, r: bufio.NewReader(conn)}
+
+	// 两个协议共享同一个缓存
+	c.do("set mc_key_a 0 0 5\r\nhello\r\n", "STORED")
+	rc.do("hello", "GET", "mc_key_a")
+	rc.do("+OK", "SET", "mc_key_b", "world")
+	c.do("get mc_key_b\r\n", "VALUE mc_key_b 0 5", "world", "END")
+}
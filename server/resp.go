@@ -0,0 +1,173 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// RESP2协议的限制, 超过的请求认为是非法请求
+const (
+	maxArgs      = 1 << 20
+	maxBulkLen   = 512 << 20
+	maxInlineLen = 64 << 10
+)
+
+var (
+	errProtocol = errors.New("ERR Protocol error")
+	crlf        = []byte("\r\n")
+)
+
+// reader 解析客户端的请求, 支持RESP数组和inline命令
+type reader struct {
+	r *bufio.Reader
+}
+
+func newReader(r io.Reader) *reader {
+	return &reader{r: bufio.NewReader(r)}
+}
+
+// Buffered 缓冲区中还没有处理的请求, 为0的时候才需要flush响应, 实现pipeline
+func (r *reader) Buffered() int {
+	return r.r.Buffered()
+}
+
+// ReadCommand 读取一条命令, 返回命令和参数
+func (r *reader) ReadCommand() ([][]byte, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) == 0 {
+		return nil, nil
+	}
+
+	if line[0] != '*' {
+		return bytes.Fields(line), nil
+	}
+
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n < -1 || n > maxArgs {
+		return nil, errProtocol
+	}
+
+	// 和redis一样, 空数组和null数组忽略
+	if n <= 0 {
+		return nil, nil
+	}
+
+	var args = make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		arg, err := r.readBulk()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+func (r *reader) readBulk() ([]byte, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) == 0 || line[0] != '$' {
+		return nil, errProtocol
+	}
+
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n < 0 || n > maxBulkLen {
+		return nil, errProtocol
+	}
+
+	var buf = make([]byte, n+2)
+	if _, err := io.ReadFull(r.r, buf); err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(buf[n:], crlf) {
+		return nil, errProtocol
+	}
+	return buf[:n], nil
+}
+
+func (r *reader) readLine() ([]byte, error) {
+	var line []byte
+	for {
+		frag, err := r.r.ReadSlice('\n')
+		line = append(line, frag...)
+		if err == nil {
+			break
+		}
+
+		if err != bufio.ErrBufferFull {
+			return nil, err
+		}
+
+		if len(line) > maxInlineLen {
+			return nil, errProtocol
+		}
+	}
+	return bytes.TrimRight(line, "\r\n"), nil
+}
+
+// writer 写入RESP2格式的响应
+type writer struct {
+	w   *bufio.Writer
+	buf []byte
+}
+
+func newWriter(w io.Writer) *writer {
+	return &writer{w: bufio.NewWriter(w)}
+}
+
+func (w *writer) Flush() error {
+	return w.w.Flush()
+}
+
+func (w *writer) WriteString(s string) {
+	w.w.WriteByte('+')
+	w.w.WriteString(s)
+	w.w.Write(crlf)
+}
+
+func (w *writer) WriteError(s string) {
+	w.w.WriteByte('-')
+	w.w.WriteString(s)
+	w.w.Write(crlf)
+}
+
+func (w *writer) WriteInt(n int64) {
+	w.writeHeader(':', n)
+}
+
+func (w *writer) WriteBulk(b []byte) {
+	if b == nil {
+		w.WriteNull()
+		return
+	}
+
+	w.writeHeader('$', int64(len(b)))
+	w.w.Write(b)
+	w.w.Write(crlf)
+}
+
+func (w *writer) WriteNull() {
+	w.w.WriteString("$-1\r\n")
+}
+
+func (w *writer) WriteArray(n int) {
+	w.writeHeader('*', int64(n))
+}
+
+func (w *writer) writeHeader(prefix byte, n int64) {
+	w.buf = append(w.buf[:0], prefix)
+	w.buf = strconv.AppendInt(w.buf, n, 10)
+	w.buf = append(w.buf, crlf...)
+	w.w.Write(w.buf)
+}
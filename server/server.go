@@ -0,0 +1,203 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"github.com/pubgo/xcache"
+	"github.com/pubgo/xcache/consts"
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrServerClosed Serve在Close之后返回的错误
+var ErrServerClosed = errors.New("xcache: server closed")
+
+// Server 缓存服务, 命令映射到IXCache
+// 同一个Server可以同时监听RESP2和memcached协议, 共享同一个缓存
+type Server struct {
+	cache   xcache.IXCache
+	startAt time.Time
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// CacheOptions 按照redis和memcached的语义创建缓存需要的配置
+// 过期时间的范围是[minTTL, maxTTL], maxTTL小于等于0的时候没有上限, key最短1个字节
+func CacheOptions(minTTL, maxTTL time.Duration) []xcache.Option {
+	if maxTTL <= 0 {
+		maxTTL = math.MaxInt64
+	}
+
+	return []xcache.Option{
+		xcache.WithMinExpiration(minTTL),
+		xcache.WithMaxExpiration(maxTTL),
+		xcache.WithMinDataSize(consts.MinDataSizeLimit),
+	}
+}
+
+// New ...
+func New(cache xcache.IXCache) *Server {
+	return &Server{
+		cache:     cache,
+		startAt:   time.Now(),
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+// ListenAndServe 监听TCP地址addr, 使用RESP2协议
+func (s *Server) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Serve 使用RESP2协议处理ln上的连接, 直到Close
+func (s *Server) Serve(ln net.Listener) error {
+	return s.serve(ln, s.serveConn)
+}
+
+// ListenAndServeMemcache 监听TCP地址addr, 使用memcached协议
+func (s *Server) ListenAndServeMemcache(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.ServeMemcache(ln)
+}
+
+// ServeMemcache 使用memcached文本协议和meta协议处理ln上的连接, 直到Close
+func (s *Server) ServeMemcache(ln net.Listener) error {
+	return s.serve(ln, s.serveMemcacheConn)
+}
+
+func (s *Server) serve(ln net.Listener, handle func(conn net.Conn)) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		_ = ln.Close()
+		return ErrServerClosed
+	}
+	s.listeners[ln] = struct{}{}
+	s.mu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(time.Millisecond * 10)
+				continue
+			}
+			return err
+		}
+
+		if !s.track(conn) {
+			_ = conn.Close()
+			return ErrServerClosed
+		}
+
+		go handle(conn)
+	}
+}
+
+// Close 关闭监听和所有连接, 并等待连接处理结束
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+
+	var err error
+	for ln := range s.listeners {
+		if cErr := ln.Close(); err == nil {
+			err = cErr
+		}
+	}
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	s.wg.Add(1)
+	return true
+}
+
+func (s *Server) untrack(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+	s.wg.Done()
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.untrack(conn)
+	defer conn.Close()
+
+	r := newReader(conn)
+	w := newWriter(conn)
+
+	// 命令处理中的panic只关闭当前连接, 不影响其他连接
+	defer func() {
+		if err := recover(); err != nil {
+			w.WriteError(fmt.Sprintf("ERR %v", err))
+			_ = w.Flush()
+		}
+	}()
+
+	for {
+		args, err := r.ReadCommand()
+		if err != nil {
+			if err == errProtocol {
+				w.WriteError(err.Error())
+				_ = w.Flush()
+			}
+			return
+		}
+
+		if len(args) == 0 {
+			continue
+		}
+
+		quit := s.exec(w, args)
+
+		// pipeline中的命令处理完之后再flush
+		if r.Buffered() == 0 || quit {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+
+		if quit {
+			return
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/pubgo/xcache"
+	"github.com/pubgo/xerror"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// client 测试用的RESP2客户端, 回复统一转换成字符串方便比较
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func newTestServer(t *testing.T) (*Server, *client) {
+	cache, err := xcache.New(CacheOptions(time.Millisecond, 0)...)
+	xerror.Panic(err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	xerror.Panic(err)
+
+	srv := New(cache)
+	go srv.Serve(ln)
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	xerror.Panic(err)
+	return srv, &client{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+func (c *client) send(args ...string) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	_, err := c.conn.Write([]byte(b.String()))
+	xerror.Panic(err)
+}
+
+func (c *client) reply() string {
+	line, err := c.r.ReadString('\n')
+	xerror.Panic(err)
+	line = strings.TrimRight(line, "\r\n")
+
+	switch line[0] {
+	case '$':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return "(nil)"
+		}
+		var buf = make([]byte, n+2)
+		_, err := io.ReadFull(c.r, buf)
+		xerror.Panic(err)
+		return string(buf[:n])
+	case '*':
+		n, _ := strconv.Atoi(line[1:])
+		var items []string
+		for i := 0; i < n; i++ {
+			items = append(items, c.reply())
+		}
+		return "[" + strings.Join(items, " ") + "]"
+	default:
+		return line
+	}
+}
+
+func (c *client) do(expected string, args ...string) {
+	c.t.Helper()
+	c.send(args...)
+	if got := c.reply(); got != expected {
+		c.t.Fatalf("%v: expected %q, got %q", args, expected, got)
+	}
+}
+
+func TestServer(t *testing.T) {
+	srv, c := newTestServer(t)
+	defer srv.Close()
+
+	c.do("+PONG", "PING")
+	c.do("hello", "PING", "hello")
+	c.do("(nil)", "GET", "server_a")
+	c.do("+OK", "SET", "server_a", "value")
+	c.do("value", "GET", "server_a")
+	c.do(":1", "EXISTS", "server_a", "server_b")
+	c.do("+OK", "SET", "server_b", "value", "EX", "10")
+	c.do(":2", "EXISTS", "server_a", "server_b")
+	c.do("+OK", "SET", "server_c", "value", "PX", "10000")
+	c.do("-ERR syntax error", "SET", "server_c", "value", "NX")
+	c.do("+OK", "SET", "server_c", "value", "EX", "3600")
+	c.do(":3600", "TTL", "server_c")
+	c.do("+OK", "SET", "server_c", "value", "EX", "1")
+	c.do(":1", "TTL", "server_c")
+	c.do(":1", "EXPIRE", "server_c", "120")
+	c.do(":120", "TTL", "server_c")
+	c.do("+OK", "SET", "server_c", "value", "EX", "3153600000")
+	c.do(":3153600000", "TTL", "server_c")
+	c.do("+OK", "SET", "server_c", "value", "PX", "10000")
+	c.do("-ERR key or value length out of range", "SET", "", "value")
+
+	// 短key
+	c.do("(nil)", "GET", "foo")
+	c.do(":0", "EXPIRE", "foo", "20")
+	c.do(":1", "INCR", "foo")
+	c.do(":1", "EXPIRE", "foo", "20")
+	c.do(":1", "DEL", "foo")
+
+	c.do(":-2", "TTL", "server_d")
+	c.do(":-1", "TTL", "server_a")
+	c.do(":1", "EXPIRE", "server_a", "20")
+	c.do(":20", "TTL", "server_a")
+	c.do(":0", "EXPIRE", "server_d", "20")
+	c.send("PTTL", "server_a")
+	if ms, _ := strconv.Atoi(strings.TrimPrefix(c.reply(), ":")); ms <= 19000 || ms > 20000 {
+		t.Fatalf("unexpected pttl %d", ms)
+	}
+	c.do(":1", "PERSIST", "server_b")
+	c.do(":-1", "TTL", "server_b")
+	c.do(":0", "PERSIST", "server_b")
+	c.do(":0", "PERSIST", "server_d")
+
+	c.do("+OK", "MSET", "server_e", "1", "server_f", "2")
+	c.do("[1 (nil) 2]", "MGET", "server_e", "server_d", "server_f")
+	c.do(":2", "INCR", "server_e")
+	c.do(":1", "INCR", "server_g")
+	c.do("-ERR value is not an integer or out of range", "INCR", "server_a")
+
+	c.do(":6", "DBSIZE")
+	c.do(":2", "DEL", "server_e", "server_f", "server_d")
+	c.do(":4", "DBSIZE")
+	c.do("-ERR unknown command 'FOO'", "FOO")
+	c.do("-ERR wrong number of arguments for 'get' command", "GET")
+
+	c.send("INFO")
+	if info := c.reply(); !strings.Contains(info, "db0:keys=4") {
+		t.Fatalf("unexpected info %q", info)
+	}
+}
+
+func TestServerPipeline(t *testing.T) {
+	srv, c := newTestServer(t)
+	defer srv.Close()
+
+	// inline命令和pipeline
+	_, err := c.conn.Write([]byte("SET server_a 1\r\nINCR server_a\r\nGET server_a\r\n"))
+	xerror.Panic(err)
+	for _, expected := range []string{"+OK", ":2", "2"} {
+		if got := c.reply(); got != expected {
+			t.Fatalf("expected %q, got %q", expected, got)
+		}
+	}
+
+	c.do("+OK", "QUIT")
+	if _, err := c.r.ReadByte(); err == nil {
+		t.Fatal("expected the connection to be closed")
+	}
+}
+
+func TestServerProtocol(t *testing.T) {
+	srv, c := newTestServer(t)
+	defer srv.Close()
+
+	// 和redis一样忽略空数组和null数组
+	_, err := c.conn.Write([]byte("*0\r\n*-1\r\n"))
+	xerror.Panic(err)
+	c.do("+PONG", "PING")
+
+	// 参数数量小于-1的数组不是合法的命令
+	_, err = c.conn.Write([]byte("*-2\r\n"))
+	xerror.Panic(err)
+	if got := c.reply(); got != "-"+errProtocol.Error() {
+		t.Fatalf("unexpected reply %q", got)
+	}
+	if _, err := c.r.ReadByte(); err == nil {
+		t.Fatal("expected the connection to be closed")
+	}
+}
+
+func TestServerClose(t *testing.T) {
+	srv, c := newTestServer(t)
+	c.do("+PONG", "PING")
+
+	xerror.Panic(srv.Close())
+	if _, err := c.r.ReadByte(); err == nil {
+		t.Fatal("expected the connection to be closed")
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	xerror.Panic(err)
+	if err := srv.Serve(ln); err != ErrServerClosed {
+		t.Fatalf("expected ErrServerClosed, got %v", err)
+	}
+}
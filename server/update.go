@@ -0,0 +1,68 @@
+package server
+
+import (
+	"errors"
+	"github.com/pubgo/xcache"
+	"time"
+)
+
+// update 读取之后再写入, 通过cas检测并发修改, 冲突的时候重试, 保留flags和原来的过期时间
+// key不存在的时候返回ErrKeyNotFound, fn返回错误的时候不写入
+func (s *Server) update(key []byte, fn func(val []byte, meta xcache.Meta) ([]byte, error)) ([]byte, xcache.Meta, error) {
+	for {
+		val, meta, err := s.cache.GetWithMeta(key)
+		if err != nil {
+			return nil, meta, err
+		}
+
+		val, err = fn(val, meta)
+		if err != nil {
+			return nil, meta, err
+		}
+
+		// 检查cas和保留过期时间在同一次写入中完成
+		meta.CAS, err = s.cache.SetWithMetaOptions(key, val, xcache.SetOptions{KeepTTL: true}, meta)
+		if errors.Is(err, xcache.ErrCASMismatch) {
+			continue
+		}
+
+		if err != nil {
+			return nil, meta, err
+		}
+		return val, meta, nil
+	}
+}
+
+// store 写入数据和flags, 过期时间不经过SnowSlideStrategy, meta.CAS不为0的时候检查cas
+func (s *Server) store(key, val []byte, e time.Duration, meta xcache.Meta) (uint64, error) {
+	return s.cache.SetWithMetaOptions(key, val, xcache.SetOptions{TTL: e, Exact: true}, meta)
+}
+
+// replace key存在的时候写入新的数据, flags和过期时间, 通过cas检测并发修改
+func (s *Server) replace(key, val []byte, e time.Duration, flags uint32) (uint64, error) {
+	for {
+		_, meta, err := s.cache.GetWithMeta(key)
+		if err != nil {
+			return 0, err
+		}
+
+		cas, err := s.store(key, val, e, xcache.Meta{Flags: flags, CAS: meta.CAS})
+		if errors.Is(err, xcache.ErrCASMismatch) {
+			continue
+		}
+		return cas, err
+	}
+}
+
+// add key不存在或者已经过期的时候写入, 返回是否写入
+func (s *Server) add(key, val []byte, e time.Duration, flags uint32) (bool, uint64, error) {
+	cas, err := s.cache.SetWithMetaOptions(key, val, xcache.SetOptions{TTL: e, Exact: true, NX: true}, xcache.Meta{Flags: flags})
+	if errors.Is(err, xcache.ErrKeyExists) {
+		return false, 0, nil
+	}
+
+	if err != nil {
+		return false, 0, err
+	}
+	return true, cas, nil
+}
@@ -0,0 +1,56 @@
+package xcache
+
+import (
+	"github.com/pubgo/xcache/ringbuf"
+	"go.uber.org/atomic"
+	"sync"
+)
+
+// shard 缓存分片, 每个分片有独立的锁, 元数据和RingBuf
+// 分片通过key的hash选择, 分片数量是2的幂
+type shard struct {
+	mu       sync.RWMutex
+	size     atomic.Uint32
+	count    atomic.Uint32
+	rb       *ringbuf.RingBuf
+	headItem *headItem
+	policy   EvictionPolicy
+	window   *window
+	stats    shardStats
+}
+
+func newShard() *shard {
+	return &shard{
+		rb:       ringbuf.NewRingBuf(),
+		headItem: newHeadItem(),
+	}
+}
+
+func newShards(n int) []*shard {
+	var shards = make([]*shard, n)
+	for i := range shards {
+		shards[i] = newShard()
+	}
+	return shards
+}
+
+// shard 根据key的hash选择分片
+func (x *xcache) shard(h1 uint32) *shard {
+	return x.shards[h1&x.shardMask]
+}
+
+// shardBufSize 每个分片的最大缓存, MaxBufSize平均分配到每个分片
+func (x *xcache) shardBufSize() uint32 {
+	return x.opts.MaxBufSize / uint32(len(x.shards))
+}
+
+// groupByShard 按照分片对keys分组, errs中已经有错误的key会被跳过
+func (x *xcache) groupByShard(hs []uint32, errs []error) [][]int {
+	var groups = make([][]int, len(x.shards))
+	for i, h1 := range hs {
+		if errs[i] == nil {
+			groups[h1&x.shardMask] = append(groups[h1&x.shardMask], i)
+		}
+	}
+	return groups
+}
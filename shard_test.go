@@ -0,0 +1,161 @@
+package xcache
+
+import (
+	"errors"
+	"fmt"
+	"github.com/pubgo/xerror"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+func TestShardCount(t *testing.T) {
+	for _, n := range []int{0, 3, 2048} {
+		if _, err := New(WithShardCount(n)); !errors.Is(err, ErrShardCount) {
+			t.Fatalf("ShardCount %d: expected ErrShardCount, got %v", n, err)
+		}
+	}
+
+	x := xerror.PanicErr(New(WithShardCount(4))).(*xcache)
+	if len(x.shards) != 4 {
+		t.Fatalf("expected 4 shards, got %d", len(x.shards))
+	}
+
+	xerror.Panic(x.Set([]byte("shard_key"), []byte("v"), time.Second*10))
+	if err := x.Init(WithShardCount(8)); !errors.Is(err, ErrShardCount) {
+		t.Fatalf("expected ErrShardCount for a non-empty cache, got %v", err)
+	}
+}
+
+func TestShardConcurrent(t *testing.T) {
+	x := xerror.PanicErr(New()).(*xcache)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				key := []byte(fmt.Sprintf("shard_%d_%d", g, i))
+				xerror.Panic(x.Set(key, key, time.Second*10))
+				val, err := x.Get(key)
+				xerror.Panic(err)
+				if string(val) != string(key) {
+					t.Errorf("unexpected value %s for %s", val, key)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if x.Count() != 8*500 {
+		t.Fatalf("expected %d items, got %d", 8*500, x.Count())
+	}
+
+	var size uint32
+	for _, s := range x.shards {
+		if s.count.Load() == 0 {
+			t.Fatal("keys should be spread over every shard")
+		}
+		size += s.size.Load()
+	}
+	if size != x.Size() {
+		t.Fatalf("Size %d should aggregate the shards %d", x.Size(), size)
+	}
+}
+
+func TestItemHeadSize(t *testing.T) {
+	if n := unsafe.Sizeof(itemHead{}); n != 32 {
+		t.Fatalf("expected itemHead to be 32 bytes, got %d", n)
+	}
+}
+
+func TestItemExt(t *testing.T) {
+	x := xerror.PanicErr(New(WithShardCount(1))).(*xcache)
+	s := x.shards[0]
+
+	xerror.Panic(x.Set([]byte("plain_key"), []byte("v"), time.Second*10))
+	if len(s.headItem.ext) != 0 {
+		t.Fatalf("plain Set should not store itemExt, got %d", len(s.headItem.ext))
+	}
+
+	xerror.Panic(x.SetWithOptions([]byte("slide_key"), []byte("v"), SetOptions{TTL: time.Second * 10, Mode: ExpireSliding}))
+	if len(s.headItem.ext) != 1 {
+		t.Fatalf("sliding Set should store itemExt, got %d", len(s.headItem.ext))
+	}
+	if _, err := x.Get([]byte("slide_key")); err != nil {
+		t.Fatal(err)
+	}
+
+	// 覆盖成普通数据之后删除itemExt
+	xerror.Panic(x.Set([]byte("slide_key"), []byte("v"), time.Second*10))
+	if len(s.headItem.ext) != 0 {
+		t.Fatalf("overwrite should drop itemExt, got %d", len(s.headItem.ext))
+	}
+
+	xerror.Panic(x.SetWithOptions([]byte("slide_key"), []byte("v"), SetOptions{TTL: time.Second * 10, Mode: ExpireSliding}))
+	xerror.Panic(x.Delete([]byte("slide_key")))
+	if len(s.headItem.ext) != 0 {
+		t.Fatalf("Delete should drop itemExt, got %d", len(s.headItem.ext))
+	}
+}
+
+// baseItem 改动之前的item, 一共16字节
+type baseItem struct {
+	_        uint8
+	key      uint8
+	size     uint16
+	index    uint32
+	expireAt int64
+}
+
+// BenchmarkItemMap 对比分片中每个key元信息常驻的内存, B/key是GC之后map中每个key的平均大小
+func BenchmarkItemMap(b *testing.B) {
+	const n = 1 << 16
+	measure := func(b *testing.B, fill func() interface{}) {
+		var before, after runtime.MemStats
+		var total uint64
+		for i := 0; i < b.N; i++ {
+			runtime.GC()
+			runtime.ReadMemStats(&before)
+			m := fill()
+			runtime.GC()
+			runtime.ReadMemStats(&after)
+			runtime.KeepAlive(m)
+			total += after.HeapAlloc - before.HeapAlloc
+		}
+		b.ReportMetric(float64(total)/float64(b.N)/n, "B/key")
+	}
+
+	b.Run("base", func(b *testing.B) {
+		measure(b, func() interface{} {
+			m := make(map[uint32]baseItem)
+			for i := uint32(0); i < n; i++ {
+				m[i] = baseItem{index: i}
+			}
+			return m
+		})
+	})
+
+	b.Run("itemHead", func(b *testing.B) {
+		measure(b, func() interface{} {
+			m := make(map[uint32]itemHead)
+			for i := uint32(0); i < n; i++ {
+				m[i] = itemHead{index: i}
+			}
+			return m
+		})
+	})
+	// 不拆分itemExt的时候每个key的大小
+	b.Run("item", func(b *testing.B) {
+		measure(b, func() interface{} {
+			m := make(map[uint32]item)
+			for i := uint32(0); i < n; i++ {
+				m[i] = item{itemHead: itemHead{index: i}}
+			}
+			return m
+		})
+	})
+}
@@ -0,0 +1,247 @@
+package xcache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"github.com/pubgo/xcache/consts"
+	"github.com/pubgo/xerror"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 快照格式:
+// header: magic(4) | version(2) | savedAt(8)
+// record: keyLen(uvarint) | valLen(uvarint) | ttl(uvarint) | flags(uvarint) | key | val | crc32(4)
+// footer: 0(uvarint) | count(uvarint)
+// ttl是保存快照时剩余的过期时间(纳秒), crc32覆盖record中除crc32之外的所有字节
+// 版本1的record没有flags字段
+const (
+	snapshotMagic   = "XCSN"
+	snapshotVersion = 2
+
+	// 单条数据的最大长度, 超过的认为快照已经损坏
+	maxSnapshotRecord = consts.DataSizeLimit
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+type snapshotEntry struct {
+	key   []byte
+	val   []byte
+	ttl   int64
+	flags uint32
+}
+
+// Save 把所有未过期的数据写入w
+func (x *xcache) Save(w io.Writer) (err error) {
+	defer xerror.RespErr(&err)
+
+	var bw = bufio.NewWriter(w)
+	var now = time.Now().UnixNano()
+
+	var header [14]byte
+	copy(header[:4], snapshotMagic)
+	binary.BigEndian.PutUint16(header[4:6], snapshotVersion)
+	binary.BigEndian.PutUint64(header[6:], uint64(now))
+	_, err = bw.Write(header[:])
+	xerror.Panic(err)
+
+	var count uint64
+	var buf []byte
+	for _, s := range x.shards {
+		for _, ent := range x.snapshotShard(s, now) {
+			buf = buf[:0]
+			buf = appendUvarint(buf, uint64(len(ent.key)))
+			buf = appendUvarint(buf, uint64(len(ent.val)))
+			buf = appendUvarint(buf, uint64(ent.ttl))
+			buf = appendUvarint(buf, uint64(ent.flags))
+			buf = append(buf, ent.key...)
+			buf = append(buf, ent.val...)
+
+			var sum [4]byte
+			binary.BigEndian.PutUint32(sum[:], crc32.Checksum(buf, crcTable))
+			buf = append(buf, sum[:]...)
+
+			_, err = bw.Write(buf)
+			xerror.Panic(err)
+			count++
+		}
+	}
+
+	buf = appendUvarint(buf[:0], 0)
+	buf = appendUvarint(buf, count)
+	_, err = bw.Write(buf)
+	xerror.Panic(err)
+	return bw.Flush()
+}
+
+// snapshotShard 复制分片中未过期数据的引用, RingBuf中的数据不会被原地修改, 释放锁之后可以安全读取
+func (x *xcache) snapshotShard(s *shard, now int64) []snapshotEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var ents = make([]snapshotEntry, 0, s.count.Load())
+	var add = func(itm itemHead) {
+		// 不存在的标记不保存
+		if itm.expireAt <= now || itm.negative {
+			return
+		}
+
+		dt := s.rb.Get(itm.index)
+		ents = append(ents, snapshotEntry{key: dt[:itm.key], val: dt[itm.key:], ttl: itm.expireAt - now, flags: itm.flags})
+	}
+
+	for _, itm := range s.headItem.items {
+		add(itm)
+	}
+	for _, itm := range s.headItem.dup {
+		add(itm)
+	}
+	return ents
+}
+
+// Load 从r中恢复数据, 已经过期的数据会被跳过, 超过MaxBufSize的数据会被跳过
+func (x *xcache) Load(r io.Reader) (err error) {
+	defer xerror.RespErr(&err)
+
+	var cr = &crcReader{r: bufio.NewReader(r), h: crc32.New(crcTable)}
+	var now = time.Now().UnixNano()
+
+	var header [14]byte
+	_, err = io.ReadFull(cr.r, header[:])
+	xerror.Panic(err)
+
+	if string(header[:4]) != snapshotMagic {
+		return xerror.WrapF(ErrSnapshot, "magic: %q", header[:4])
+	}
+
+	version := binary.BigEndian.Uint16(header[4:6])
+	if version < 1 || version > snapshotVersion {
+		return xerror.WrapF(ErrSnapshot, "version: %d", version)
+	}
+	savedAt := int64(binary.BigEndian.Uint64(header[6:]))
+
+	var count uint64
+	for {
+		cr.h.Reset()
+		keyLen, err := binary.ReadUvarint(cr)
+		xerror.Panic(err)
+
+		if keyLen == 0 {
+			total, err := binary.ReadUvarint(cr)
+			xerror.Panic(err)
+
+			if total != count {
+				return xerror.WrapF(ErrSnapshot, "count: %d, expected: %d", count, total)
+			}
+			return nil
+		}
+
+		valLen, err := binary.ReadUvarint(cr)
+		xerror.Panic(err)
+
+		ttl, err := binary.ReadUvarint(cr)
+		xerror.Panic(err)
+
+		var flags uint64
+		if version > 1 {
+			flags, err = binary.ReadUvarint(cr)
+			xerror.Panic(err)
+		}
+
+		if keyLen+valLen > maxSnapshotRecord || flags > 1<<32-1 {
+			return xerror.WrapF(ErrSnapshot, "record size: %d", keyLen+valLen)
+		}
+
+		var dt = make([]byte, keyLen+valLen)
+		_, err = io.ReadFull(cr, dt)
+		xerror.Panic(err)
+
+		sum := cr.h.Sum32()
+		var crc [4]byte
+		_, err = io.ReadFull(cr.r, crc[:])
+		xerror.Panic(err)
+
+		if binary.BigEndian.Uint32(crc[:]) != sum {
+			return xerror.WrapF(ErrSnapshot, "checksum mismatch at record %d", count)
+		}
+		count++
+
+		expireAt := savedAt + int64(ttl)
+		if expireAt <= now {
+			continue
+		}
+
+		// 超过长度限制的数据跳过, 超过MaxBufSize的数据跳过
+		ent, err := x.newEntryAt(dt[:keyLen], dt[keyLen:], expireAt)
+		if err != nil {
+			continue
+		}
+		ent.itm.flags = uint32(flags)
+
+		s := x.shard(ent.h1)
+		s.mu.Lock()
+		_ = x.setItem(s, ent)
+		s.mu.Unlock()
+	}
+}
+
+// SaveFile 先写入临时文件再重命名, 防止写到一半的快照覆盖旧的快照
+func (x *xcache) SaveFile(path string) (err error) {
+	defer xerror.RespErr(&err)
+
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	xerror.Panic(err)
+	defer func() {
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+		}
+	}()
+
+	xerror.Panic(x.Save(f))
+	xerror.Panic(f.Sync())
+	xerror.Panic(f.Close())
+	return os.Rename(f.Name(), path)
+}
+
+// LoadFile ...
+func (x *xcache) LoadFile(path string) (err error) {
+	defer xerror.RespErr(&err)
+
+	f, err := os.Open(path)
+	xerror.Panic(err)
+	defer f.Close()
+
+	return x.Load(f)
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	return append(buf, tmp[:binary.PutUvarint(tmp[:], v)]...)
+}
+
+// crcReader 读取数据的同时计算crc32
+type crcReader struct {
+	r *bufio.Reader
+	h hash.Hash32
+}
+
+func (c *crcReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		_, _ = c.h.Write([]byte{b})
+	}
+	return b, err
+}
+
+func (c *crcReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	_, _ = c.h.Write(p[:n])
+	return n, err
+}
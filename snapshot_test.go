@@ -0,0 +1,67 @@
+package xcache
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/pubgo/xerror"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSnapshot(t *testing.T) {
+	x := xerror.PanicErr(New()).(*xcache)
+	for i := 0; i < 100; i++ {
+		key := []byte(fmt.Sprintf("snapshot_%d", i))
+		xerror.Panic(x.Set(key, key, time.Second*10))
+	}
+
+	var buf bytes.Buffer
+	xerror.Panic(x.Save(&buf))
+	data := buf.Bytes()
+
+	y := xerror.PanicErr(New()).(*xcache)
+	xerror.Panic(y.Load(bytes.NewReader(data)))
+	if y.Count() != 100 {
+		t.Fatalf("expected 100 items, got %d", y.Count())
+	}
+
+	val, err := y.Get([]byte("snapshot_42"))
+	xerror.Panic(err)
+	if string(val) != "snapshot_42" {
+		t.Fatalf("unexpected value %s", val)
+	}
+
+	// 损坏的快照
+	corrupt := append([]byte{}, data...)
+	corrupt[len(corrupt)/2] ^= 0xff
+	z := xerror.PanicErr(New()).(*xcache)
+	if err := z.Load(bytes.NewReader(corrupt)); err == nil {
+		t.Fatal("expected an error for a corrupt snapshot")
+	}
+
+	// 截断的快照
+	if err := z.Load(bytes.NewReader(data[:len(data)-3])); err == nil {
+		t.Fatal("expected an error for a truncated snapshot")
+	}
+}
+
+func TestSnapshotFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xcache")
+	xerror.Panic(err)
+	defer os.RemoveAll(dir)
+
+	x := xerror.PanicErr(New()).(*xcache)
+	xerror.Panic(x.Set([]byte("snapshot_file"), []byte("v"), time.Second*10))
+
+	path := filepath.Join(dir, "xcache.snapshot")
+	xerror.Panic(x.SaveFile(path))
+
+	y := xerror.PanicErr(New()).(*xcache)
+	xerror.Panic(y.LoadFile(path))
+	if _, err := y.Get([]byte("snapshot_file")); err != nil {
+		t.Fatal(err)
+	}
+}
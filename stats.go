@@ -0,0 +1,195 @@
+package xcache
+
+import (
+	"go.uber.org/atomic"
+	"time"
+)
+
+// LoaderLatencyBuckets 数据加载耗时直方图每个桶的上界
+var LoaderLatencyBuckets = [...]time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// LatencyHistogram 耗时直方图
+type LatencyHistogram struct {
+	// Buckets 耗时不超过LoaderLatencyBuckets中对应上界的次数, 累加计数
+	Buckets [len(LoaderLatencyBuckets)]uint64
+	// Count 总次数, 包括超过最大上界的
+	Count uint64
+	// Sum 总耗时
+	Sum time.Duration
+}
+
+// Stats 缓存的统计信息, 从创建或者上一次ResetStats开始累计
+type Stats struct {
+	// Hits 命中次数
+	Hits uint64
+	// Misses 未命中次数, 包括已经过期的数据
+	Misses uint64
+	// NegativeHits 读取到不存在的标记的次数, 不算作命中和未命中
+	NegativeHits uint64
+	// StaleHits GetWithDataLoad返回过期的旧数据的次数, 这些读取同时也算作未命中
+	StaleHits uint64
+	// Sets 写入成功的次数
+	Sets uint64
+	// Deletes 调用Delete删除成功的次数
+	Deletes uint64
+	// LazyExpirations 读取的时候发现过期, 惰性删除的数量
+	LazyExpirations uint64
+	// JanitorExpirations 定期清理和DeleteExpired删除的过期数据数量
+	JanitorExpirations uint64
+	// Evictions 淘汰策略淘汰的数量
+	Evictions uint64
+	// BufExceeded 超过最大缓存, 返回ErrBufExceeded的次数
+	BufExceeded uint64
+	// LoaderCalls 调用数据加载函数的次数, 批量加载算一次
+	LoaderCalls uint64
+	// LoaderErrors 数据加载函数返回错误或者panic的次数, 不包括ErrNotExist
+	LoaderErrors uint64
+	// LoaderTimeouts 数据加载超时的次数
+	LoaderTimeouts uint64
+	// SharedLoads 通过singleflight共享其他调用方加载结果的次数
+	SharedLoads uint64
+	// BloomRejected 布隆过滤器判断key不存在, 没有调用数据加载函数的次数
+	BloomRejected uint64
+	// EarlyRefreshes XFetch提前刷新的次数, 同一个key正在刷新的时候也会计数
+	EarlyRefreshes uint64
+	// LoaderLatency 数据加载函数的耗时, 超时的加载在函数返回之后统计
+	LoaderLatency LatencyHistogram
+}
+
+// HitRatio 命中率, 没有读取的时候返回0
+func (s Stats) HitRatio() float64 {
+	if total := s.Hits + s.Misses; total > 0 {
+		return float64(s.Hits) / float64(total)
+	}
+	return 0
+}
+
+// shardStats 分片的计数器, 分散到每个分片减少多核之间的竞争
+type shardStats struct {
+	hits               atomic.Uint64
+	misses             atomic.Uint64
+	staleHits          atomic.Uint64
+	negativeHits       atomic.Uint64
+	sets               atomic.Uint64
+	deletes            atomic.Uint64
+	lazyExpirations    atomic.Uint64
+	janitorExpirations atomic.Uint64
+	evictions          atomic.Uint64
+	bufExceeded        atomic.Uint64
+}
+
+// loaderStats 数据加载的计数器, 数据加载本身的开销远大于计数
+type loaderStats struct {
+	calls          atomic.Uint64
+	errors         atomic.Uint64
+	timeouts       atomic.Uint64
+	shared         atomic.Uint64
+	earlyRefreshes atomic.Uint64
+	bloomRejected  atomic.Uint64
+
+	latency      [len(LoaderLatencyBuckets)]atomic.Uint64
+	latencyCount atomic.Uint64
+	latencySum   atomic.Int64
+}
+
+// observe 记录一次数据加载的耗时
+func (s *loaderStats) observe(d time.Duration) {
+	for i, b := range LoaderLatencyBuckets {
+		if d <= b {
+			s.latency[i].Inc()
+			break
+		}
+	}
+	s.latencyCount.Inc()
+	s.latencySum.Add(int64(d))
+}
+
+// histogram 把每个桶的计数累加成LatencyHistogram
+func (s *loaderStats) histogram() LatencyHistogram {
+	var h = LatencyHistogram{
+		Count: s.latencyCount.Load(),
+		Sum:   time.Duration(s.latencySum.Load()),
+	}
+
+	var n uint64
+	for i := range s.latency {
+		n += s.latency[i].Load()
+		h.Buckets[i] = n
+	}
+	return h
+}
+
+// Stats 汇总所有分片的统计信息
+func (x *xcache) Stats() Stats {
+	var st = Stats{
+		LoaderCalls:    x.loaderStats.calls.Load(),
+		LoaderErrors:   x.loaderStats.errors.Load(),
+		LoaderTimeouts: x.loaderStats.timeouts.Load(),
+		SharedLoads:    x.loaderStats.shared.Load(),
+		EarlyRefreshes: x.loaderStats.earlyRefreshes.Load(),
+		BloomRejected:  x.loaderStats.bloomRejected.Load(),
+		LoaderLatency:  x.loaderStats.histogram(),
+	}
+
+	for _, s := range x.shards {
+		st.Hits += s.stats.hits.Load()
+		st.Misses += s.stats.misses.Load()
+		st.StaleHits += s.stats.staleHits.Load()
+		st.NegativeHits += s.stats.negativeHits.Load()
+		st.Sets += s.stats.sets.Load()
+		st.Deletes += s.stats.deletes.Load()
+		st.LazyExpirations += s.stats.lazyExpirations.Load()
+		st.JanitorExpirations += s.stats.janitorExpirations.Load()
+		st.Evictions += s.stats.evictions.Load()
+		st.BufExceeded += s.stats.bufExceeded.Load()
+	}
+	return st
+}
+
+// ResetStats 清空统计信息
+func (x *xcache) ResetStats() {
+	x.loaderStats.reset()
+	for _, s := range x.shards {
+		s.stats.reset()
+	}
+}
+
+func (s *shardStats) reset() {
+	s.hits.Store(0)
+	s.misses.Store(0)
+	s.staleHits.Store(0)
+	s.negativeHits.Store(0)
+	s.sets.Store(0)
+	s.deletes.Store(0)
+	s.lazyExpirations.Store(0)
+	s.janitorExpirations.Store(0)
+	s.evictions.Store(0)
+	s.bufExceeded.Store(0)
+}
+
+func (s *loaderStats) reset() {
+	s.calls.Store(0)
+	s.errors.Store(0)
+	s.timeouts.Store(0)
+	s.shared.Store(0)
+	s.earlyRefreshes.Store(0)
+	s.bloomRejected.Store(0)
+	for i := range s.latency {
+		s.latency[i].Store(0)
+	}
+	s.latencyCount.Store(0)
+	s.latencySum.Store(0)
+}
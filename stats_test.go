@@ -0,0 +1,107 @@
+package xcache
+
+import (
+	"context"
+	"errors"
+	"github.com/pubgo/xerror"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	x := xerror.PanicErr(New()).(*xcache)
+	key := []byte("stats_key")
+
+	xerror.Panic(x.Set(key, []byte("v"), time.Second*10))
+	_, _ = x.Get(key)
+	_, _ = x.Get([]byte("stats_missing"))
+	_, _ = x.MGet([][]byte{key, []byte("stats_missing")})
+	xerror.Panic(x.Delete(key))
+	_ = x.Delete(key)
+
+	st := x.Stats()
+	if st.Sets != 1 || st.Hits != 2 || st.Misses != 2 || st.Deletes != 1 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+	if st.HitRatio() != 0.5 {
+		t.Fatalf("unexpected hit ratio %f", st.HitRatio())
+	}
+
+	// 数据加载
+	_, _ = x.GetWithDataLoad([]byte("stats_load"), time.Second*10, func(k []byte) ([]byte, error) {
+		return []byte("v"), nil
+	})
+	_, _ = x.GetWithDataLoad([]byte("stats_error"), time.Second*10, func(k []byte) ([]byte, error) {
+		return nil, errors.New("load error")
+	})
+	_, _ = x.GetWithDataLoad([]byte("stats_panic"), time.Second*10, func(k []byte) ([]byte, error) {
+		panic("load panic")
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	_, _ = x.GetWithDataLoadCtx(ctx, []byte("stats_timeout"), time.Second*10, func(ctx context.Context, k []byte) ([]byte, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	// 超时之后数据加载函数在后台返回
+	time.Sleep(time.Millisecond * 50)
+	st = x.Stats()
+	if st.LoaderCalls != 4 || st.LoaderErrors != 3 || st.LoaderTimeouts != 1 {
+		t.Fatalf("unexpected loader stats %+v", st)
+	}
+	if h := st.LoaderLatency; h.Count != 4 || h.Buckets[0] < 3 || h.Buckets[len(h.Buckets)-1] != 4 || h.Sum < time.Millisecond*10 {
+		t.Fatalf("unexpected loader latency %+v", h)
+	}
+
+	x.ResetStats()
+	if st = x.Stats(); st != (Stats{}) {
+		t.Fatalf("expected empty stats, got %+v", st)
+	}
+}
+
+func TestStatsShared(t *testing.T) {
+	x := xerror.PanicErr(New()).(*xcache)
+
+	var start = make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = x.GetWithDataLoad([]byte("stats_shared"), time.Second*10, func(k []byte) ([]byte, error) {
+				<-start
+				return []byte("v"), nil
+			})
+		}()
+	}
+
+	time.Sleep(time.Millisecond * 50)
+	close(start)
+	wg.Wait()
+
+	st := x.Stats()
+	if st.LoaderCalls+st.SharedLoads != 10 || st.SharedLoads == 0 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+}
+
+func TestStatsExpiration(t *testing.T) {
+	x := xerror.PanicErr(New()).(*xcache)
+	xerror.Panic(x.Init(func(o *Options) { o.SnowSlideStrategy = nil }))
+
+	xerror.Panic(x.Set([]byte("stats_lazy"), []byte("v"), x.opts.MinExpiration))
+	xerror.Panic(x.Set([]byte("stats_janitor"), []byte("v"), x.opts.MinExpiration))
+	time.Sleep(x.opts.MinExpiration)
+
+	_, _ = x.Get([]byte("stats_lazy"))
+	time.Sleep(time.Millisecond * 50)
+	xerror.Panic(x.DeleteExpired())
+
+	st := x.Stats()
+	if st.LazyExpirations != 1 || st.JanitorExpirations != 1 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+}
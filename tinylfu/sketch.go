@@ -0,0 +1,64 @@
+package tinylfu
+
+// cmSketch count-min sketch, 每个计数器4bit, 最大值15
+type cmSketch struct {
+	rows [cmDepth][]byte
+	mask uint64
+}
+
+const cmDepth = 4
+
+// 每一行使用不同的种子, 减少hash冲突
+var cmSeeds = [cmDepth]uint64{0xc3a5c85c97cb3127, 0xb492b66fbe98f273, 0x9ae16a3b2f90404f, 0xcbf29ce484222325}
+
+func newCmSketch(n int) *cmSketch {
+	// 计数器数量取2的幂, 每个byte存储两个计数器
+	size := uint64(16)
+	for size < uint64(n) {
+		size <<= 1
+	}
+
+	s := &cmSketch{mask: size - 1}
+	for i := range s.rows {
+		s.rows[i] = make([]byte, size/2)
+	}
+	return s
+}
+
+func (s *cmSketch) index(h uint64, i int) (uint64, uint) {
+	h = (h ^ cmSeeds[i]) * 0x9e3779b97f4a7c15
+	h ^= h >> 32
+	pos := h & s.mask
+	return pos >> 1, uint(pos&1) * 4
+}
+
+// Increment 计数加一
+func (s *cmSketch) Increment(h uint64) {
+	for i := range s.rows {
+		idx, shift := s.index(h, i)
+		if v := (s.rows[i][idx] >> shift) & 0x0f; v < 15 {
+			s.rows[i][idx] += 1 << shift
+		}
+	}
+}
+
+// Estimate 估算访问频率, 取所有行的最小值
+func (s *cmSketch) Estimate(h uint64) byte {
+	var min = byte(15)
+	for i := range s.rows {
+		idx, shift := s.index(h, i)
+		if v := (s.rows[i][idx] >> shift) & 0x0f; v < min {
+			min = v
+		}
+	}
+	return min
+}
+
+// Reset 所有计数减半, 让旧的访问频率逐渐衰减
+func (s *cmSketch) Reset() {
+	for _, row := range s.rows {
+		for j := range row {
+			row[j] = (row[j] >> 1) & 0x77
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package tinylfu
+
+import (
+	"github.com/pubgo/xcache/bloom"
+	"math/bits"
+	"sync"
+)
+
+// maxShards sketch的最大分片数量, minShardSize 每个分片最少统计的数据数量
+const (
+	maxShards    = 16
+	minShardSize = 64
+)
+
+// TinyLFU W-TinyLFU的准入策略, window LRU由xcache的每个分片提供
+// 1. 访问频率使用count-min sketch统计, 每sampleSize次访问所有计数减半
+// 2. doorkeeper布隆过滤器过滤只出现一次的key, 防止扫描类的访问污染sketch
+// 3. sketch和doorkeeper按照hash分片, Record只锁一个分片, 并发的Get不会竞争同一把锁
+type TinyLFU struct {
+	shards []*counter
+	shift  uint
+}
+
+// counter 一个分片的访问频率统计
+type counter struct {
+	mu         sync.Mutex
+	sketch     *cmSketch
+	door       *bloom.Filter
+	additions  int
+	sampleSize int
+}
+
+// New capacity是缓存预计可以存放的数据数量
+func New(capacity int) *TinyLFU {
+	if capacity < 100 {
+		capacity = 100
+	}
+
+	// 分片数量取2的幂, 每个分片至少统计minShardSize个数据
+	n := maxShards
+	for n > 1 && capacity/n < minShardSize {
+		n >>= 1
+	}
+
+	t := &TinyLFU{
+		shards: make([]*counter, n),
+		shift:  uint(64 - bits.TrailingZeros(uint(n))),
+	}
+	for i := range t.shards {
+		t.shards[i] = &counter{
+			sketch:     newCmSketch(capacity / n),
+			door:       bloom.New(capacity/n, 0.01),
+			sampleSize: capacity * 10 / n,
+		}
+	}
+	return t
+}
+
+// shard 使用hash的高位选择分片, 低位留给sketch和doorkeeper, 只有一个分片的时候shift是64, 结果是0
+func (t *TinyLFU) shard(h uint64) *counter {
+	return t.shards[h>>t.shift]
+}
+
+// Record 记录一次访问, 命中和未命中都需要记录
+func (t *TinyLFU) Record(h uint64) {
+	c := t.shard(h)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// 第一次出现的key只记录在doorkeeper中
+	if c.door.Add(h) {
+		c.sketch.Increment(h)
+	}
+
+	c.additions++
+	if c.additions >= c.sampleSize {
+		c.sketch.Reset()
+		c.door.Reset()
+		c.additions = 0
+	}
+}
+
+// Estimate 估算访问频率
+func (t *TinyLFU) Estimate(h uint64) int {
+	c := t.shard(h)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := int(c.sketch.Estimate(h))
+	if c.door.Has(h) {
+		n++
+	}
+	return n
+}
+
+// Admit window中的数据candidate的访问频率比淘汰数据victim高的时候, candidate进入主区域
+func (t *TinyLFU) Admit(candidate, victim uint64) bool {
+	return t.Estimate(candidate) > t.Estimate(victim)
+}
@@ -0,0 +1,123 @@
+package tinylfu
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/pubgo/xcache"
+	"github.com/pubgo/xerror"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSketch(t *testing.T) {
+	s := newCmSketch(1024)
+	for i := 0; i < 20; i++ {
+		s.Increment(1)
+	}
+	s.Increment(2)
+
+	if n := s.Estimate(1); n != 15 {
+		t.Fatalf("expected the counter to saturate at 15, got %d", n)
+	}
+	if n := s.Estimate(2); n != 1 {
+		t.Fatalf("expected 1, got %d", n)
+	}
+
+	s.Reset()
+	if n := s.Estimate(1); n != 7 {
+		t.Fatalf("expected 7 after aging, got %d", n)
+	}
+	if n := s.Estimate(2); n != 0 {
+		t.Fatalf("expected 0 after aging, got %d", n)
+	}
+}
+
+func TestAdmit(t *testing.T) {
+	lfu := New(1000)
+	for i := 0; i < 10; i++ {
+		lfu.Record(1)
+	}
+	lfu.Record(2)
+
+	if lfu.Estimate(2) != 1 {
+		t.Fatalf("expected the doorkeeper to count a single access, got %d", lfu.Estimate(2))
+	}
+	if lfu.Admit(2, 1) {
+		t.Fatal("a cold candidate must not displace a hot victim")
+	}
+	if !lfu.Admit(1, 2) {
+		t.Fatal("a hot candidate should displace a cold victim")
+	}
+	if lfu.Admit(3, 2) {
+		t.Fatal("a candidate must be more frequent than the victim")
+	}
+}
+
+func TestRecordParallel(t *testing.T) {
+	lfu := New(100000)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for h := uint64(0); h < 1000; h++ {
+				lfu.Record(h * 0x9e3779b97f4a7c15)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for h := uint64(0); h < 1000; h++ {
+		if n := lfu.Estimate(h * 0x9e3779b97f4a7c15); n < 8 {
+			t.Fatalf("expected at least 8 accesses of %d, got %d", h, n)
+		}
+	}
+}
+
+// BenchmarkZipf Zipf分布的访问, 每次扫描之后对比命中率
+func BenchmarkZipf(b *testing.B) {
+	const (
+		bufSize  = 10 << 20
+		valSize  = 1 << 10
+		keySpace = 1 << 20
+		capacity = bufSize / valSize
+	)
+
+	run := func(b *testing.B, opts ...xcache.Option) {
+		x, err := xcache.New(append(opts, xcache.WithEvictionPolicy(xcache.NewLRUPolicy))...)
+		xerror.Panic(err)
+		xerror.Panic(x.Init(func(o *xcache.Options) { o.MaxBufSize = bufSize }))
+
+		var val = bytes.Repeat([]byte("v"), valSize)
+		var zipf = rand.NewZipf(rand.New(rand.NewSource(1)), 1.01, 1, keySpace-1)
+		var hits, scan int
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			var key []byte
+			if i%10 == 0 {
+				// 混入扫描类的访问
+				key = []byte(fmt.Sprintf("scan_%08d", scan))
+				scan++
+			} else {
+				key = []byte(fmt.Sprintf("zipf_%08d", zipf.Uint64()))
+			}
+
+			if _, err := x.Get(key); err == nil {
+				hits++
+				continue
+			}
+			_ = x.Set(key, val, time.Minute)
+		}
+		b.ReportMetric(float64(hits)*100/float64(b.N), "hit%")
+	}
+
+	b.Run("lru", func(b *testing.B) {
+		run(b)
+	})
+
+	b.Run("lru+tinylfu", func(b *testing.B) {
+		run(b, xcache.WithAdmissionPolicy(func() xcache.AdmissionPolicy { return New(capacity) }))
+	})
+}
@@ -0,0 +1,46 @@
+package xcache
+
+import (
+	"context"
+)
+
+// span的名字
+const (
+	// SpanLookup 查询缓存, 包括等待分片的读锁
+	SpanLookup = "xcache.lookup"
+	// SpanJoin 等待singleflight的结果, 发起加载的调用方也会等待
+	SpanJoin = "xcache.singleflight"
+	// SpanLoad 调用数据加载函数
+	SpanLoad = "xcache.load"
+)
+
+// Tracer 链路追踪, 为查询, 数据加载和singleflight等待创建span, 实现需要保证并发安全
+// 只追踪单个key的查询和加载, 可以参考otel.NewTracer
+type Tracer interface {
+	// Start 开始一个span, 返回的ctx会传给后续的操作, 例如SpanJoin的ctx会传给数据加载函数
+	Start(ctx context.Context, name string, keySize int) (context.Context, Span)
+}
+
+// Span 一次被追踪的操作
+type Span interface {
+	// SetHit 查询是否命中, 只有SpanLookup会调用
+	SetHit(hit bool)
+	// SetShared 是否共享了其他调用方的加载结果, 只有SpanJoin会调用
+	SetShared(shared bool)
+	// End 结束span, err不为nil的时候记录错误
+	End(err error)
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetHit(bool)    {}
+func (noopSpan) SetShared(bool) {}
+func (noopSpan) End(error)      {}
+
+// startSpan 没有设置Tracer的时候返回noopSpan
+func (x *xcache) startSpan(ctx context.Context, name string, keySize int) (context.Context, Span) {
+	if x.opts.Tracer == nil {
+		return ctx, noopSpan{}
+	}
+	return x.opts.Tracer.Start(ctx, name, keySize)
+}
@@ -0,0 +1,63 @@
+package otel
+
+import (
+	"context"
+	"github.com/pubgo/xcache"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/pubgo/xcache"
+
+// span的属性
+const (
+	HitKey     = attribute.Key("xcache.hit")
+	SharedKey  = attribute.Key("xcache.shared")
+	KeySizeKey = attribute.Key("xcache.key_size")
+)
+
+var _ xcache.Tracer = (*Tracer)(nil)
+
+// Tracer 把xcache的span转换成OpenTelemetry的span
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// NewTracer 创建Tracer, tp为nil的时候使用全局的TracerProvider
+// 例如: xcache.New(xcache.WithTracer(otel.NewTracer(nil)))
+func NewTracer(tp trace.TracerProvider) *Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return &Tracer{tracer: tp.Tracer(instrumentationName)}
+}
+
+// Start ...
+func (t *Tracer) Start(ctx context.Context, name string, keySize int) (context.Context, xcache.Span) {
+	ctx, span := t.tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(KeySizeKey.Int(keySize)))
+	return ctx, &otelSpan{span: span}
+}
+
+type otelSpan struct {
+	span trace.Span
+}
+
+func (s *otelSpan) SetHit(hit bool) {
+	s.span.SetAttributes(HitKey.Bool(hit))
+}
+
+func (s *otelSpan) SetShared(shared bool) {
+	s.span.SetAttributes(SharedKey.Bool(shared))
+}
+
+func (s *otelSpan) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
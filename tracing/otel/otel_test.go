@@ -0,0 +1,64 @@
+package otel
+
+import (
+	"github.com/pubgo/xcache"
+	"github.com/pubgo/xerror"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTracer(t *testing.T) {
+	var rec = tracetest.NewSpanRecorder()
+	var tp = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+
+	cache, err := xcache.New(xcache.WithTracer(NewTracer(tp)))
+	xerror.Panic(err)
+
+	var start = make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = cache.GetWithDataLoad([]byte("trace_key"), time.Second*10, func(k []byte) ([]byte, error) {
+				<-start
+				return []byte("v"), nil
+			})
+		}()
+	}
+	time.Sleep(time.Millisecond * 50)
+	close(start)
+	wg.Wait()
+	_, _ = cache.Get([]byte("trace_key"))
+
+	var counts = make(map[string]int)
+	var hits, shared int
+	for _, span := range rec.Ended() {
+		counts[span.Name()]++
+		for _, attr := range span.Attributes() {
+			switch {
+			case attr.Key == HitKey && attr.Value.AsBool():
+				hits++
+			case attr.Key == SharedKey && attr.Value.AsBool():
+				shared++
+			case attr.Key == KeySizeKey && attr.Value.AsInt64() != int64(len("trace_key")):
+				t.Fatalf("%s: unexpected key size %d", span.Name(), attr.Value.AsInt64())
+			}
+		}
+
+		// 数据加载的span在发起加载的singleflight span下面
+		if span.Name() == xcache.SpanLoad && !span.Parent().IsValid() {
+			t.Fatal("expected parent span for load")
+		}
+	}
+
+	if counts[xcache.SpanLookup] != 3 || counts[xcache.SpanJoin] != 2 || counts[xcache.SpanLoad] != 1 {
+		t.Fatalf("unexpected spans %v", counts)
+	}
+	if hits != 1 || shared != 1 {
+		t.Fatalf("unexpected hits %d, shared %d", hits, shared)
+	}
+}
@@ -0,0 +1,60 @@
+package typed
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+)
+
+// Codec 值的编码和解码, 实现需要保证并发安全
+type Codec[V any] interface {
+	Marshal(v V) ([]byte, error)
+	Unmarshal(data []byte) (V, error)
+}
+
+// JSON 使用encoding/json编码
+type JSON[V any] struct{}
+
+// Marshal ...
+func (JSON[V]) Marshal(v V) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal ...
+func (JSON[V]) Unmarshal(data []byte) (V, error) {
+	var v V
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+// Gob 使用encoding/gob编码, 每个值单独编码, 会包含类型信息
+type Gob[V any] struct{}
+
+// Marshal ...
+func (Gob[V]) Marshal(v V) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal ...
+func (Gob[V]) Unmarshal(data []byte) (V, error) {
+	var v V
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v)
+	return v, err
+}
+
+// Raw 不编码, 直接保存[]byte, 缓存中的数据是只读的, 不能修改Unmarshal返回的数据
+type Raw struct{}
+
+// Marshal ...
+func (Raw) Marshal(v []byte) ([]byte, error) {
+	return v, nil
+}
+
+// Unmarshal ...
+func (Raw) Unmarshal(data []byte) ([]byte, error) {
+	return data, nil
+}
@@ -0,0 +1,43 @@
+package typed
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// KeyEncoder 把K转换成缓存的key, 不同的K必须转换成不同的key
+type KeyEncoder[K comparable] interface {
+	EncodeKey(k K) []byte
+}
+
+// KeyEncoderFunc ...
+type KeyEncoderFunc[K comparable] func(k K) []byte
+
+// EncodeKey ...
+func (f KeyEncoderFunc[K]) EncodeKey(k K) []byte {
+	return f(k)
+}
+
+// StringKey string类型的key, 直接使用字符串的内容
+func StringKey[K ~string]() KeyEncoder[K] {
+	return KeyEncoderFunc[K](func(k K) []byte {
+		return []byte(k)
+	})
+}
+
+// IntKey 整数类型的key, 使用8字节大端编码, 满足MinDataSize的限制
+func IntKey[K ~int | ~int8 | ~int16 | ~int32 | ~int64 | ~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64]() KeyEncoder[K] {
+	return KeyEncoderFunc[K](func(k K) []byte {
+		var b = make([]byte, 8)
+		binary.BigEndian.PutUint64(b, uint64(k))
+		return b
+	})
+}
+
+// PrefixKey 在prefix后面加上fmt.Sprint(k), 用于结构体等其他类型的key
+// fmt.Sprint的结果必须能够区分不同的key, 例如不能用于包含指针的结构体
+func PrefixKey[K comparable](prefix string) KeyEncoder[K] {
+	return KeyEncoderFunc[K](func(k K) []byte {
+		return []byte(prefix + fmt.Sprint(k))
+	})
+}
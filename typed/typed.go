@@ -0,0 +1,92 @@
+package typed
+
+import (
+	"context"
+	"github.com/pubgo/xcache"
+	"github.com/pubgo/xerror"
+	"time"
+)
+
+// Cache 类型安全的缓存, key通过KeyEncoder转换, 值通过Codec编码之后保存在IXCache中
+type Cache[K comparable, V any] struct {
+	cache xcache.IXCache
+	keys  KeyEncoder[K]
+	codec Codec[V]
+}
+
+// New 创建Cache, 例如: New[string, User](cache, StringKey[string](), JSON[User]{})
+func New[K comparable, V any](cache xcache.IXCache, keys KeyEncoder[K], codec Codec[V]) *Cache[K, V] {
+	return &Cache[K, V]{cache: cache, keys: keys, codec: codec}
+}
+
+// XCache 底层的IXCache
+func (c *Cache[K, V]) XCache() xcache.IXCache {
+	return c.cache
+}
+
+// Get ...
+func (c *Cache[K, V]) Get(k K) (V, error) {
+	return c.GetCtx(context.Background(), k)
+}
+
+// GetCtx ...
+func (c *Cache[K, V]) GetCtx(ctx context.Context, k K) (V, error) {
+	dt, err := c.cache.GetCtx(ctx, c.keys.EncodeKey(k))
+	if err != nil {
+		var v V
+		return v, err
+	}
+	return c.decode(k, dt)
+}
+
+// Set ...
+func (c *Cache[K, V]) Set(k K, v V, e time.Duration) error {
+	return c.SetCtx(context.Background(), k, v, e)
+}
+
+// SetCtx ...
+func (c *Cache[K, V]) SetCtx(ctx context.Context, k K, v V, e time.Duration) error {
+	dt, err := c.codec.Marshal(v)
+	if err != nil {
+		return xerror.WrapF(err, "key: %v", k)
+	}
+	return c.cache.SetCtx(ctx, c.keys.EncodeKey(k), dt, e)
+}
+
+// Delete ...
+func (c *Cache[K, V]) Delete(k K) error {
+	return c.DeleteCtx(context.Background(), k)
+}
+
+// DeleteCtx ...
+func (c *Cache[K, V]) DeleteCtx(ctx context.Context, k K) error {
+	return c.cache.DeleteCtx(ctx, c.keys.EncodeKey(k))
+}
+
+// GetWithDataLoad key不存在的时候调用fn加载数据, 加载的数据编码之后写入缓存
+func (c *Cache[K, V]) GetWithDataLoad(k K, e time.Duration, fn func(k K) (V, error)) (V, error) {
+	return c.GetWithDataLoadCtx(context.Background(), k, e, func(_ context.Context, k K) (V, error) {
+		return fn(k)
+	})
+}
+
+// GetWithDataLoadCtx 通过singleflight共享加载结果的调用方拿到的是同一份编码之后的数据, 每个调用方单独解码
+func (c *Cache[K, V]) GetWithDataLoadCtx(ctx context.Context, k K, e time.Duration, fn func(ctx context.Context, k K) (V, error)) (V, error) {
+	dt, err := c.cache.GetWithDataLoadCtx(ctx, c.keys.EncodeKey(k), e, func(ctx context.Context, _ []byte) ([]byte, error) {
+		v, err := fn(ctx, k)
+		if err != nil {
+			return nil, err
+		}
+		return c.codec.Marshal(v)
+	})
+	if err != nil {
+		var v V
+		return v, err
+	}
+	return c.decode(k, dt)
+}
+
+func (c *Cache[K, V]) decode(k K, dt []byte) (V, error) {
+	v, err := c.codec.Unmarshal(dt)
+	return v, xerror.WrapF(err, "key: %v", k)
+}
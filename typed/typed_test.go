@@ -0,0 +1,89 @@
+package typed
+
+import (
+	"errors"
+	"github.com/pubgo/xcache"
+	"github.com/pubgo/xerror"
+	"testing"
+	"time"
+)
+
+type user struct {
+	Name string
+	Age  int
+}
+
+func TestCache(t *testing.T) {
+	cache, err := xcache.New()
+	xerror.Panic(err)
+
+	for name, codec := range map[string]Codec[user]{"json": JSON[user]{}, "gob": Gob[user]{}} {
+		c := New[string, user](cache, StringKey[string](), codec)
+		key := "typed_" + name
+
+		if _, err := c.Get(key); !errors.Is(err, xcache.ErrKeyNotFound) {
+			t.Fatalf("%s: expected ErrKeyNotFound, got %v", name, err)
+		}
+
+		xerror.Panic(c.Set(key, user{Name: "a", Age: 1}, time.Second*10))
+		if u, err := c.Get(key); err != nil || u != (user{Name: "a", Age: 1}) {
+			t.Fatalf("%s: unexpected %+v, %v", name, u, err)
+		}
+
+		xerror.Panic(c.Delete(key))
+		if _, err := c.Get(key); !errors.Is(err, xcache.ErrKeyNotFound) {
+			t.Fatalf("%s: expected ErrKeyNotFound, got %v", name, err)
+		}
+	}
+}
+
+func TestCacheWithDataLoad(t *testing.T) {
+	cache, err := xcache.New()
+	xerror.Panic(err)
+	c := New[int64, []int](cache, IntKey[int64](), JSON[[]int]{})
+
+	var calls int
+	var load = func(k int64) ([]int, error) {
+		calls++
+		return []int{int(k), int(k) * 2}, nil
+	}
+
+	for i := 0; i < 2; i++ {
+		v, err := c.GetWithDataLoad(3, time.Second*10, load)
+		if err != nil || len(v) != 2 || v[1] != 6 {
+			t.Fatalf("unexpected %v, %v", v, err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("expected 1 call, got %d", calls)
+	}
+
+	var errLoad = errors.New("load error")
+	_, err = c.GetWithDataLoad(4, time.Second*10, func(k int64) ([]int, error) {
+		return nil, errLoad
+	})
+	if !errors.Is(err, errLoad) {
+		t.Fatalf("expected load error, got %v", err)
+	}
+}
+
+func TestCacheRaw(t *testing.T) {
+	cache, err := xcache.New()
+	xerror.Panic(err)
+
+	type id struct{ A, B int }
+	c := New[id, []byte](cache, PrefixKey[id]("typed:"), Raw{})
+	xerror.Panic(c.Set(id{1, 2}, []byte("v"), time.Second*10))
+	if v, err := c.Get(id{1, 2}); err != nil || string(v) != "v" {
+		t.Fatalf("unexpected %q, %v", v, err)
+	}
+	if v, err := cache.Get([]byte("typed:{1 2}")); err != nil || string(v) != "v" {
+		t.Fatalf("unexpected %q, %v", v, err)
+	}
+
+	// 解码失败
+	xerror.Panic(cache.Set([]byte("typed_bad"), []byte("{"), time.Second*10))
+	if _, err := New[string, user](cache, StringKey[string](), JSON[user]{}).Get("typed_bad"); err == nil {
+		t.Fatal("expected decode error")
+	}
+}
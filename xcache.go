@@ -1,6 +1,8 @@
 package xcache
 
 import (
+	"context"
+	"io"
 	"time"
 )
 
@@ -12,8 +14,44 @@ type IXCache interface {
 	GetWithDataLoad(k []byte, e time.Duration, fn ...func(k []byte) (v []byte, err error)) ([]byte, error)
 	Delete(k []byte) error
 	DeleteExpired() error
+	TTL(k []byte) (time.Duration, error)
+	Expire(k []byte, e time.Duration) error
+	Touch(k []byte, e time.Duration) error
+	SetWithOptions(k, v []byte, opts SetOptions) error
+	IncrBy(k []byte, delta int64, e time.Duration) (int64, error)
+	DecrBy(k []byte, delta int64, e time.Duration) (int64, error)
+	GetAndTouch(k []byte, e time.Duration) ([]byte, error)
+	Persist(k []byte) error
+	GetWithMeta(k []byte) ([]byte, Meta, error)
+	SetWithMeta(k, v []byte, e time.Duration, meta Meta) (uint64, error)
+	SetWithMetaOptions(k, v []byte, opts SetOptions, meta Meta) (uint64, error)
+	DeleteWithCAS(k []byte, cas uint64) error
+	GetWithVersion(k []byte) ([]byte, uint64, error)
+	CompareAndSwap(k, v []byte, version uint64, e time.Duration) (uint64, error)
+	SetNX(k, v []byte, e time.Duration) (bool, error)
+	Range(fn func(k, v []byte, ttl time.Duration) bool)
+	Scan(cursor uint64, count int, match string) ([][]byte, uint64)
+	Flush() error
+	GetCtx(ctx context.Context, k []byte) ([]byte, error)
+	SetCtx(ctx context.Context, k, v []byte, e time.Duration) error
+	GetSetCtx(ctx context.Context, k, v []byte, e time.Duration) ([]byte, error)
+	GetWithDataLoadCtx(ctx context.Context, k []byte, e time.Duration, fn ...func(ctx context.Context, k []byte) (v []byte, err error)) ([]byte, error)
+	DeleteCtx(ctx context.Context, k []byte) error
+	DeleteExpiredCtx(ctx context.Context) error
+	MGet(keys [][]byte) ([][]byte, []error)
+	MSet(keys, vals [][]byte, e time.Duration) []error
+	MDelete(keys [][]byte) []error
+	MGetWithDataLoad(keys [][]byte, e time.Duration, fn func(keys [][]byte) ([][]byte, error)) ([][]byte, []error)
+	MGetCtx(ctx context.Context, keys [][]byte) ([][]byte, []error)
+	MSetCtx(ctx context.Context, keys, vals [][]byte, e time.Duration) []error
+	MDeleteCtx(ctx context.Context, keys [][]byte) []error
+	MGetWithDataLoadCtx(ctx context.Context, keys [][]byte, e time.Duration, fn func(ctx context.Context, keys [][]byte) ([][]byte, error)) ([][]byte, []error)
 	Size() uint32
 	Count() uint32
+	FreeSlots() uint32
+	AddKnownKeys(keys ...[]byte) error
+	Stats() Stats
+	ResetStats()
 	Init(opts ...Option) error
 	Option() Options
 }
@@ -35,20 +73,59 @@ type Options struct {
 	ClearTime    time.Duration
 	ClearRate    float32
 	Delimiter    string
+	// 分片数量, 必须是2的幂, 每个分片的最大缓存是MaxBufSize/ShardCount
+	ShardCount int
+
+	// AOF文件路径, 为空的时候不开启AOF, New的时候会重放AOF文件恢复数据
+	AOFPath string
+	// AOF的fsync策略
+	AOFSync FsyncPolicy
+	// AOF文件比上一次重写之后增长超过AOFRewriteSize的时候自动重写, 小于等于0不自动重写
+	AOFRewriteSize int64
+
+	// 数据加载函数返回ErrNotExist的时候, 不存在的标记的过期时间, 过期之前直接返回ErrKeyNotFound
+	NegativeTTL time.Duration
+
+	// 过期之后GetWithDataLoad还可以返回旧数据的时间, 返回旧数据的同时在后台刷新, 为0的时候不返回旧数据
+	// 过期时间是soft TTL, 过期时间加上StaleTime是hard TTL, 超过hard TTL的数据才会被删除
+	StaleTime time.Duration
+
+	// 布隆过滤器预计的key数量, 超过之后自动扩容, 为0的时候不开启
+	// 开启之后, 布隆过滤器中一定不存在的key直接返回ErrKeyNotFound, 不调用数据加载函数
+	BloomSize int
+	// 布隆过滤器的误判率
+	BloomFP float64
+
+	// XFetch提前刷新的系数, 大于1的时候更早刷新, 为0的时候不提前刷新
+	// GetWithDataLoad命中的时候按照剩余的过期时间和上一次加载的耗时计算概率, 在后台刷新
+	XFetchBeta float64
+
 	// 定期清理时间
 	Interval time.Duration
 
 	// 防止雪崩策略
 	SnowSlideStrategy func(expired time.Duration) time.Duration
-	// 防止穿透策略
-	PenetrateStrategy func(k []byte, fn ...func(k []byte) ([]byte, error)) ([]byte, error)
+	// 防止穿透策略, ctx的deadline优先于DataLoadTime
+	PenetrateStrategy func(ctx context.Context, k []byte, fn ...func(ctx context.Context, k []byte) ([]byte, error)) ([]byte, error)
 	// 防止击穿策略
 	BreakdownStrategy func([]byte, []byte, time.Duration) ([]byte, time.Duration)
+	// 淘汰策略, 为nil的时候超过MaxBufSize直接返回ErrBufExceeded
+	Eviction func() EvictionPolicy
+	// 准入策略, 需要同时设置淘汰策略才会生效
+	Admission func() AdmissionPolicy
+	// 链路追踪, 为nil的时候不追踪
+	Tracer Tracer
 }
 
 // Option 可选配置
 type Option func(o *Options)
 
+// NoExpiration 永不过期, 可以用于Set和Expire, 不受MaxExpiration的限制, 也不会经过SnowSlideStrategy
+const NoExpiration time.Duration = -1
+
+// KeyNotExist key不存在的时候TTL返回的剩余时间
+const KeyNotExist time.Duration = -2
+
 func Init(opts ...Option) error {
 	return defaultXCache.Init(opts...)
 }
@@ -84,3 +161,176 @@ func Size() uint32 {
 func Count() uint32 {
 	return defaultXCache.Count()
 }
+
+func FreeSlots() uint32 {
+	return defaultXCache.FreeSlots()
+}
+
+func AddKnownKeys(keys ...[]byte) error {
+	return defaultXCache.AddKnownKeys(keys...)
+}
+
+func DeleteCtx(ctx context.Context, k []byte) error {
+	return defaultXCache.DeleteCtx(ctx, k)
+}
+
+func SetCtx(ctx context.Context, k []byte, v []byte, e time.Duration) error {
+	return defaultXCache.SetCtx(ctx, k, v, e)
+}
+
+func GetCtx(ctx context.Context, k []byte) ([]byte, error) {
+	return defaultXCache.GetCtx(ctx, k)
+}
+
+func GetSetCtx(ctx context.Context, k []byte, v []byte, e time.Duration) ([]byte, error) {
+	return defaultXCache.GetSetCtx(ctx, k, v, e)
+}
+
+func GetWithDataLoadCtx(ctx context.Context, k []byte, e time.Duration, fn ...func(ctx context.Context, k []byte) (v []byte, err error)) ([]byte, error) {
+	return defaultXCache.GetWithDataLoadCtx(ctx, k, e, fn...)
+}
+
+func TTL(k []byte) (time.Duration, error) {
+	return defaultXCache.TTL(k)
+}
+
+func Expire(k []byte, e time.Duration) error {
+	return defaultXCache.Expire(k, e)
+}
+
+func Persist(k []byte) error {
+	return defaultXCache.Persist(k)
+}
+
+func Touch(k []byte, e time.Duration) error {
+	return defaultXCache.Touch(k, e)
+}
+
+func GetAndTouch(k []byte, e time.Duration) ([]byte, error) {
+	return defaultXCache.GetAndTouch(k, e)
+}
+
+func SetWithOptions(k, v []byte, opts SetOptions) error {
+	return defaultXCache.SetWithOptions(k, v, opts)
+}
+
+func IncrBy(k []byte, delta int64, e time.Duration) (int64, error) {
+	return defaultXCache.IncrBy(k, delta, e)
+}
+
+func DecrBy(k []byte, delta int64, e time.Duration) (int64, error) {
+	return defaultXCache.DecrBy(k, delta, e)
+}
+
+func GetWithVersion(k []byte) ([]byte, uint64, error) {
+	return defaultXCache.GetWithVersion(k)
+}
+
+func CompareAndSwap(k, v []byte, version uint64, e time.Duration) (uint64, error) {
+	return defaultXCache.CompareAndSwap(k, v, version, e)
+}
+
+func SetNX(k, v []byte, e time.Duration) (bool, error) {
+	return defaultXCache.SetNX(k, v, e)
+}
+
+func Range(fn func(k, v []byte, ttl time.Duration) bool) {
+	defaultXCache.Range(fn)
+}
+
+func Scan(cursor uint64, count int, match string) ([][]byte, uint64) {
+	return defaultXCache.Scan(cursor, count, match)
+}
+
+func NewNamespace(name string, opts ...NamespaceOption) (*Namespace, error) {
+	return defaultXCache.Namespace(name, opts...)
+}
+
+func DeleteNamespace(name string) error {
+	return defaultXCache.DeleteNamespace(name)
+}
+
+func GetWithMeta(k []byte) ([]byte, Meta, error) {
+	return defaultXCache.GetWithMeta(k)
+}
+
+func SetWithMeta(k, v []byte, e time.Duration, meta Meta) (uint64, error) {
+	return defaultXCache.SetWithMeta(k, v, e, meta)
+}
+
+func SetWithMetaOptions(k, v []byte, opts SetOptions, meta Meta) (uint64, error) {
+	return defaultXCache.SetWithMetaOptions(k, v, opts, meta)
+}
+
+func DeleteWithCAS(k []byte, cas uint64) error {
+	return defaultXCache.DeleteWithCAS(k, cas)
+}
+
+func Flush() error {
+	return defaultXCache.Flush()
+}
+
+// GetStats 类型Stats已经占用了Stats这个名字
+func GetStats() Stats {
+	return defaultXCache.Stats()
+}
+
+func ResetStats() {
+	defaultXCache.ResetStats()
+}
+
+func MGet(keys [][]byte) ([][]byte, []error) {
+	return defaultXCache.MGet(keys)
+}
+
+func MSet(keys, vals [][]byte, e time.Duration) []error {
+	return defaultXCache.MSet(keys, vals, e)
+}
+
+func MDelete(keys [][]byte) []error {
+	return defaultXCache.MDelete(keys)
+}
+
+func MGetWithDataLoad(keys [][]byte, e time.Duration, fn func(keys [][]byte) ([][]byte, error)) ([][]byte, []error) {
+	return defaultXCache.MGetWithDataLoad(keys, e, fn)
+}
+
+func MGetCtx(ctx context.Context, keys [][]byte) ([][]byte, []error) {
+	return defaultXCache.MGetCtx(ctx, keys)
+}
+
+func MSetCtx(ctx context.Context, keys, vals [][]byte, e time.Duration) []error {
+	return defaultXCache.MSetCtx(ctx, keys, vals, e)
+}
+
+func MDeleteCtx(ctx context.Context, keys [][]byte) []error {
+	return defaultXCache.MDeleteCtx(ctx, keys)
+}
+
+func MGetWithDataLoadCtx(ctx context.Context, keys [][]byte, e time.Duration, fn func(ctx context.Context, keys [][]byte) ([][]byte, error)) ([][]byte, []error) {
+	return defaultXCache.MGetWithDataLoadCtx(ctx, keys, e, fn)
+}
+
+func Save(w io.Writer) error {
+	return defaultXCache.Save(w)
+}
+
+func Load(r io.Reader) error {
+	return defaultXCache.Load(r)
+}
+
+func SaveFile(path string) error {
+	return defaultXCache.SaveFile(path)
+}
+
+func LoadFile(path string) error {
+	return defaultXCache.LoadFile(path)
+}
+
+func RewriteAOF() error {
+	return defaultXCache.RewriteAOF()
+}
+
+func Close() error {
+	return defaultXCache.Close()
+}
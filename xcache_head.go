@@ -1,6 +1,7 @@
 package xcache
 
 import (
+	"sort"
 	"time"
 )
 
@@ -12,18 +13,38 @@ const (
 )
 
 type headItem struct {
-	items map[uint32]item
-	dup   map[string]item
+	items map[uint32]itemHead
+	dup   map[string]itemHead
+	// 不常用的元信息, key是RingBuf的index, 只保存extended的item
+	ext map[uint32]itemExt
+	// 所有key的hash, 用于Scan按照hash的顺序遍历
+	index hashIndex
+}
+
+func newHeadItem() *headItem {
+	return &headItem{
+		items: make(map[uint32]itemHead),
+		dup:   make(map[string]itemHead),
+		ext:   make(map[uint32]itemExt),
+	}
+}
+
+// full 加上itemExt的完整元信息
+func (x *headItem) full(h itemHead) item {
+	var itm = item{itemHead: h}
+	if h.extended {
+		itm.itemExt = x.ext[h.index]
+	}
+	return itm
 }
 
 type expiredItem struct {
-	size  uint16
-	index uint32
-	h1    uint32
+	item
+	h1 uint32
 }
 
 func (x *headItem) dupClear() {
-	var dup = make(map[string]item, len(x.dup))
+	var dup = make(map[string]itemHead, len(x.dup))
 
 	for k, v := range x.dup {
 		dup[k] = v
@@ -35,7 +56,7 @@ func (x *headItem) dupClear() {
 // 获取随机item的过期item
 func (x *headItem) randomExpired(rate float32) []expiredItem {
 	var n = int(rate * float32(len(x.items)))
-	var items = make([]expiredItem, n)
+	var items = make([]expiredItem, 0, n)
 	var now = time.Now().UnixNano()
 
 	for h1, v1 := range x.items {
@@ -43,8 +64,8 @@ func (x *headItem) randomExpired(rate float32) []expiredItem {
 			break
 		}
 
-		if v1.expireAt < now {
-			items = append(items, expiredItem{h1: h1, index: v1.index, size: v1.size})
+		if itm := x.full(v1); itm.deadline() < now {
+			items = append(items, expiredItem{h1: h1, item: itm})
 		}
 		n--
 	}
@@ -56,7 +77,7 @@ func (x *headItem) get(key string, h1 uint32) (item, keyType, bool) {
 	keyHead, ok := x.dup[key]
 	if ok {
 		if keyHead.expireAt != 0 {
-			return keyHead, keyDup, true
+			return x.full(keyHead), keyDup, true
 		}
 		return emptyItem, keyDup, false
 	}
@@ -64,7 +85,7 @@ func (x *headItem) get(key string, h1 uint32) (item, keyType, bool) {
 	keyHead, ok = x.items[h1]
 	if ok {
 		if keyHead.expireAt != 0 {
-			return keyHead, keyIndex, true
+			return x.full(keyHead), keyIndex, true
 		}
 		return emptyItem, keyIndex, false
 	}
@@ -72,18 +93,147 @@ func (x *headItem) get(key string, h1 uint32) (item, keyType, bool) {
 	return emptyItem, keyDup, false
 }
 
+// getByIndex 根据hash和RingBuf的index查找item, dup中的key会被返回
+func (x *headItem) getByIndex(h1 uint32, index uint32) (string, item, keyType, bool) {
+	if itm, ok := x.items[h1]; ok && itm.index == index {
+		return "", x.full(itm), keyIndex, true
+	}
+
+	for k, itm := range x.dup {
+		if itm.index == index {
+			return k, x.full(itm), keyDup, true
+		}
+	}
+	return "", emptyItem, keyDup, false
+}
+
 func (x *headItem) set(key string, h1 uint32, kt keyType, itm item) {
+	var old itemHead
+	var existed bool
+	if kt == keyIndex {
+		old, existed = x.items[h1]
+	} else {
+		old, existed = x.dup[key]
+	}
+
+	if existed && old.extended {
+		delete(x.ext, old.index)
+	}
+
+	itm.extended = itm.itemExt != itemExt{}
+	if itm.extended {
+		x.ext[itm.index] = itm.itemExt
+	}
+
 	if kt == keyIndex {
-		x.items[h1] = itm
+		x.items[h1] = itm.itemHead
 	} else {
-		x.dup[key] = itm
+		x.dup[key] = itm.itemHead
+	}
+
+	if !existed {
+		x.index.add(h1)
 	}
 }
 
 func (x *headItem) del(key string, h1 uint32, kt keyType) {
+	var old itemHead
+	var existed bool
 	if kt == keyIndex {
+		old, existed = x.items[h1]
 		delete(x.items, h1)
 	} else {
+		old, existed = x.dup[key]
 		delete(x.dup, key)
 	}
+
+	if !existed {
+		return
+	}
+
+	if old.extended {
+		delete(x.ext, old.index)
+	}
+	x.index.remove(h1)
+}
+
+// hashChunk hashIndex中每一块的最大长度
+const hashChunk = 256
+
+// hashIndex 有序的hash列表, 相同hash的key保存多次
+// 分成最多hashChunk个hash的有序块, 插入和删除只移动一块, 每个key只占用4个字节
+type hashIndex struct {
+	chunks [][]uint32
+}
+
+// find 第一个大于等于h1的hash所在的块和位置, 没有的时候块是len(chunks)
+func (x *hashIndex) find(h1 uint32) (int, int) {
+	ci := sort.Search(len(x.chunks), func(i int) bool {
+		c := x.chunks[i]
+		return c[len(c)-1] >= h1
+	})
+	if ci == len(x.chunks) {
+		return ci, 0
+	}
+
+	c := x.chunks[ci]
+	return ci, sort.Search(len(c), func(i int) bool { return c[i] >= h1 })
+}
+
+func (x *hashIndex) add(h1 uint32) {
+	ci, i := x.find(h1)
+	if ci == len(x.chunks) {
+		if ci == 0 {
+			x.chunks = append(x.chunks, []uint32{h1})
+			return
+		}
+
+		// 比所有的hash都大, 加到最后一块
+		ci, i = ci-1, len(x.chunks[ci-1])
+	}
+
+	c := append(x.chunks[ci], 0)
+	copy(c[i+1:], c[i:])
+	c[i] = h1
+	x.chunks[ci] = c
+	if len(c) <= hashChunk {
+		return
+	}
+
+	// 块满了之后分成两块
+	var half = len(c) / 2
+	var right = append(make([]uint32, 0, hashChunk), c[half:]...)
+	x.chunks[ci] = c[:half]
+	x.chunks = append(x.chunks, nil)
+	copy(x.chunks[ci+2:], x.chunks[ci+1:])
+	x.chunks[ci+1] = right
+}
+
+func (x *hashIndex) remove(h1 uint32) {
+	ci, i := x.find(h1)
+	if ci == len(x.chunks) || x.chunks[ci][i] != h1 {
+		return
+	}
+
+	c := x.chunks[ci]
+	if len(c) > 1 {
+		x.chunks[ci] = append(c[:i], c[i+1:]...)
+		return
+	}
+
+	copy(x.chunks[ci:], x.chunks[ci+1:])
+	x.chunks[len(x.chunks)-1] = nil
+	x.chunks = x.chunks[:len(x.chunks)-1]
+}
+
+// seek 从第一个大于等于start的hash开始按照顺序调用fn, fn返回false的时候停止
+func (x *hashIndex) seek(start uint32, fn func(h1 uint32) bool) {
+	ci, i := x.find(start)
+	for ; ci < len(x.chunks); ci, i = ci+1, 0 {
+		for _, h1 := range x.chunks[ci][i:] {
+			if !fn(h1) {
+				return
+			}
+		}
+	}
 }
@@ -2,14 +2,19 @@ package xcache
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/cespare/xxhash"
+	"github.com/pubgo/xcache/consts"
 	"github.com/pubgo/xerror"
 	"github.com/pubgo/xtest"
 	"github.com/smartystreets/gunit"
+	"go.uber.org/atomic"
 	"os"
 	"runtime"
+	"sync"
 	"testing"
 	"time"
 	"unsafe"
@@ -133,6 +138,348 @@ func (t *xcacheFixture) TestGet() {
 	fn.Do()
 }
 
+func TestGetWithDataLoadCtx(t *testing.T) {
+	x := xerror.PanicErr(New()).(*xcache)
+	key := []byte("hello_ctx")
+	load := func(ctx context.Context, k []byte) ([]byte, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	start := time.Now()
+	_, err := x.GetWithDataLoadCtx(ctx, key, time.Second*10, load)
+	if !errors.Is(err, ErrDataLoadTimeout) {
+		t.Fatalf("expected ErrDataLoadTimeout, got %v", err)
+	}
+	if time.Since(start) >= x.Option().DataLoadTime {
+		t.Fatal("ctx deadline should win over DataLoadTime")
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := x.GetWithDataLoadCtx(ctx, key, time.Second*10, load); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	// 共享的加载返回普通的错误, 所有调用方都收到这个错误
+	errLoad := errors.New("db unavailable")
+	var wg sync.WaitGroup
+	var errs = make([]error, 2)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = x.GetWithDataLoadCtx(context.Background(), key, time.Second*10, func(ctx context.Context, k []byte) ([]byte, error) {
+				time.Sleep(time.Millisecond * 50)
+				return nil, errLoad
+			})
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if !errors.Is(err, errLoad) {
+			t.Fatalf("expected %v, got %v", errLoad, err)
+		}
+	}
+
+	val, err := x.GetWithDataLoadCtx(context.Background(), key, time.Second*10, func(ctx context.Context, k []byte) ([]byte, error) {
+		return []byte("world"), nil
+	})
+	xerror.Exit(err)
+	if string(val) != "world" {
+		t.Fatalf("unexpected value %s", val)
+	}
+}
+
+// expireAt 修改key的过期时间, 不校验过期时间
+func expireAt(x *xcache, key []byte, at time.Time) {
+	h1 := x.hashKey(key)
+	s := x.shard(h1)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	itm, kt, _ := x.lookup(s, key, h1)
+	itm.expireAt = at.UnixNano()
+	s.headItem.set(string(key), h1, kt, itm)
+}
+
+func TestGetWithDataLoadStale(t *testing.T) {
+	x := xerror.PanicErr(New(WithStaleTime(time.Second * 10))).(*xcache)
+	key := []byte("hello_stale")
+
+	var calls atomic.Int32
+	var release = make(chan struct{})
+	load := func(k []byte) ([]byte, error) {
+		if calls.Inc() == 1 {
+			return []byte("v1"), nil
+		}
+		<-release
+		return []byte("v2"), nil
+	}
+
+	_, err := x.GetWithDataLoad(key, time.Second*10, load)
+	xerror.Panic(err)
+	expireAt(x, key, time.Now())
+
+	// 没有数据加载函数的时候不返回旧数据
+	if _, err := x.Get(key); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("expected ErrKeyNotFound, got %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		val, err := x.GetWithDataLoad(key, time.Second*10, load)
+		if err != nil || string(val) != "v1" {
+			t.Fatalf("expected stale value, got %s, %v", val, err)
+		}
+	}
+	close(release)
+
+	for i := 0; ; i++ {
+		if val, _ := x.Get(key); string(val) == "v2" {
+			break
+		}
+		if i > 100 {
+			t.Fatal("expected background refresh")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	if calls.Load() != 2 || x.Stats().StaleHits != 3 {
+		t.Fatalf("unexpected calls %d, stats %+v", calls.Load(), x.Stats())
+	}
+
+	// 超过StaleTime之后同步加载
+	expireAt(x, key, time.Now().Add(-time.Second*11))
+	val, err := x.GetWithDataLoad(key, time.Second*10, load)
+	if err != nil || string(val) != "v2" || calls.Load() != 3 {
+		t.Fatalf("expected reload, got %s, %v, calls %d", val, err, calls.Load())
+	}
+}
+
+func TestGetWithDataLoadXFetch(t *testing.T) {
+	for _, beta := range []float64{0, 1e6} {
+		x := xerror.PanicErr(New(WithXFetch(beta))).(*xcache)
+		key := []byte("hello_xfetch")
+
+		var calls atomic.Int32
+		load := func(k []byte) ([]byte, error) {
+			if calls.Inc() == 1 {
+				time.Sleep(time.Millisecond * 2)
+				return []byte("v1"), nil
+			}
+			return []byte("v2"), nil
+		}
+
+		_, err := x.GetWithDataLoad(key, time.Second*10, load)
+		xerror.Panic(err)
+
+		h1 := x.hashKey(key)
+		if itm, _, _ := x.lookup(x.shard(h1), key, h1); itm.delta < 2000 {
+			t.Fatalf("expected load delta, got %d", itm.delta)
+		}
+
+		// beta很大的时候命中就会提前刷新, 命中返回的还是旧的数据
+		val, err := x.GetWithDataLoad(key, time.Second*10, load)
+		if err != nil || string(val) != "v1" {
+			t.Fatalf("unexpected %s, %v", val, err)
+		}
+
+		if beta == 0 {
+			if calls.Load() != 1 || x.Stats().EarlyRefreshes != 0 {
+				t.Fatal("expected no early refresh")
+			}
+			continue
+		}
+
+		for i := 0; ; i++ {
+			if val, _ := x.Get(key); string(val) == "v2" {
+				break
+			}
+			if i > 100 {
+				t.Fatal("expected early refresh")
+			}
+			time.Sleep(time.Millisecond * 10)
+		}
+		if x.Stats().EarlyRefreshes == 0 {
+			t.Fatal("expected early refresh stats")
+		}
+	}
+}
+
+func TestGetWithDataLoadNegative(t *testing.T) {
+	x := xerror.PanicErr(New(WithNegativeTTL(time.Second * 10))).(*xcache)
+	key := []byte("hello_negative")
+
+	var calls int
+	load := func(k []byte) ([]byte, error) {
+		calls++
+		return nil, ErrNotExist
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := x.GetWithDataLoad(key, time.Second*10, load); !errors.Is(err, ErrKeyNotFound) {
+			t.Fatalf("expected ErrKeyNotFound, got %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("expected 1 call, got %d", calls)
+	}
+
+	// 不存在的标记对其他读取也是不存在的
+	if _, err := x.Get(key); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("expected ErrKeyNotFound, got %v", err)
+	}
+	if _, err := x.TTL(key); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("expected ErrKeyNotFound, got %v", err)
+	}
+	if _, _, err := x.GetWithMeta(key); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("expected ErrKeyNotFound, got %v", err)
+	}
+
+	_, errs := x.MGetWithDataLoad([][]byte{key, []byte("hello_negative_batch")}, time.Second*10, func(keys [][]byte) ([][]byte, error) {
+		if len(keys) != 1 {
+			t.Fatalf("expected 1 key, got %q", keys)
+		}
+		return nil, ErrNotExist
+	})
+	if !errors.Is(errs[0], ErrKeyNotFound) || !errors.Is(errs[1], ErrKeyNotFound) {
+		t.Fatalf("unexpected errs %v", errs)
+	}
+
+	st := x.Stats()
+	if st.NegativeHits != 5 || st.Hits != 0 || st.LoaderErrors != 0 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+
+	// 写入之后不存在的标记被覆盖
+	xerror.Panic(x.Set(key, []byte("world"), time.Second*10))
+	if val, err := x.GetWithDataLoad(key, time.Second*10, load); err != nil || string(val) != "world" {
+		t.Fatalf("unexpected %s, %v", val, err)
+	}
+}
+
+func TestNoExpiration(t *testing.T) {
+	x := xerror.PanicErr(New(WithMaxExpiration(time.Hour * 24))).(*xcache)
+	key := []byte("hello_persist")
+
+	// 超过原来1分钟上限的过期时间
+	xerror.Panic(x.Set(key, []byte("v"), time.Hour*2))
+	if ttl, err := x.TTL(key); err != nil || ttl <= time.Hour {
+		t.Fatalf("unexpected ttl %s, %v", ttl, err)
+	}
+
+	xerror.Panic(x.Persist(key))
+	if ttl, err := x.TTL(key); err != nil || ttl != NoExpiration {
+		t.Fatalf("expected NoExpiration, got %s, %v", ttl, err)
+	}
+
+	xerror.Panic(x.Set([]byte("hello_forever"), []byte("v"), NoExpiration))
+	xerror.Panic(x.DeleteExpired())
+	for _, k := range []string{"hello_persist", "hello_forever"} {
+		if val, err := x.Get([]byte(k)); err != nil || string(val) != "v" {
+			t.Fatalf("unexpected %s, %v", val, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	xerror.Panic(x.Save(&buf))
+	y := xerror.PanicErr(New()).(*xcache)
+	xerror.Panic(y.Load(&buf))
+	if ttl, err := y.TTL([]byte("hello_forever")); err != nil || ttl != NoExpiration {
+		t.Fatalf("expected NoExpiration, got %s, %v", ttl, err)
+	}
+
+	xerror.Panic(x.Expire(key, time.Second*10))
+	if ttl, err := x.TTL(key); err != nil || ttl > time.Second*10 {
+		t.Fatalf("unexpected ttl %s, %v", ttl, err)
+	}
+
+	if err := x.Init(WithMaxExpiration(time.Second)); !errors.Is(err, ErrExpiration) {
+		t.Fatalf("expected ErrExpiration, got %v", err)
+	}
+}
+
+func TestTouch(t *testing.T) {
+	x := xerror.PanicErr(New()).(*xcache)
+	key := []byte("hello_touch")
+
+	if ttl, err := x.TTL(key); !errors.Is(err, ErrKeyNotFound) || ttl != KeyNotExist {
+		t.Fatalf("expected KeyNotExist, got %s, %v", ttl, err)
+	}
+	if err := x.Touch(key, time.Second*10); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("expected ErrKeyNotFound, got %v", err)
+	}
+
+	xerror.Panic(x.Set(key, []byte("v"), time.Second*5))
+	xerror.Panic(x.Touch(key, time.Second*30))
+	if ttl, err := x.TTL(key); err != nil || ttl <= time.Second*20 {
+		t.Fatalf("unexpected ttl %s, %v", ttl, err)
+	}
+
+	// 滑动过期, 每次访问重新计算过期时间
+	expireAt(x, key, time.Now().Add(time.Millisecond*100))
+	if val, err := x.GetAndTouch(key, time.Second*10); err != nil || string(val) != "v" {
+		t.Fatalf("unexpected %s, %v", val, err)
+	}
+	if ttl, err := x.TTL(key); err != nil || ttl <= time.Second*9 {
+		t.Fatalf("unexpected ttl %s, %v", ttl, err)
+	}
+
+	expireAt(x, key, time.Now().Add(-time.Millisecond))
+	if _, err := x.GetAndTouch(key, time.Second*10); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("expected ErrKeyNotFound, got %v", err)
+	}
+
+	if st := x.Stats(); st.Hits != 1 || st.Misses != 1 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+}
+
+func TestLargeValue(t *testing.T) {
+	x := xerror.PanicErr(New()).(*xcache)
+	key := bytes.Repeat([]byte("k"), 300)
+	val := bytes.Repeat([]byte("v"), 1<<20)
+
+	if err := x.Set(key, val, time.Second*10); !errors.Is(err, ErrLength) {
+		t.Fatalf("expected ErrLength, got %v", err)
+	}
+
+	xerror.Panic(x.Init(WithMaxDataSize(2<<20), WithMaxKeySize(1024)))
+	xerror.Panic(x.Set(key, val, time.Second*10))
+	if dt, err := x.Get(key); err != nil || !bytes.Equal(dt, val) {
+		t.Fatalf("unexpected len %d, %v", len(dt), err)
+	}
+
+	var buf bytes.Buffer
+	xerror.Panic(x.Save(&buf))
+	y := xerror.PanicErr(New(WithMaxDataSize(2<<20), WithMaxKeySize(1024))).(*xcache)
+	xerror.Panic(y.Load(&buf))
+	if dt, err := y.Get(key); err != nil || !bytes.Equal(dt, val) {
+		t.Fatalf("unexpected len %d, %v", len(dt), err)
+	}
+
+	if err := x.Init(WithMaxDataSize(consts.DataSizeLimit + 1)); !errors.Is(err, ErrLength) {
+		t.Fatalf("expected ErrLength, got %v", err)
+	}
+	if err := x.Init(WithMaxKeySize(consts.KeySizeLimit + 1)); !errors.Is(err, ErrLength) {
+		t.Fatalf("expected ErrLength, got %v", err)
+	}
+
+	// 超过64M的数据需要减少分片数量, 每个分片的缓存是MaxBufSize/ShardCount
+	if err := x.Init(WithMaxDataSize(80 << 20)); !errors.Is(err, ErrLength) {
+		t.Fatalf("expected ErrLength, got %v", err)
+	}
+
+	z := xerror.PanicErr(New(WithShardCount(1), WithMaxDataSize(80<<20), WithMaxKeySize(1024))).(*xcache)
+	val = bytes.Repeat([]byte("v"), 70<<20)
+	xerror.Panic(z.Set(key, val, time.Second*10))
+	if dt, err := z.Get(key); err != nil || !bytes.Equal(dt, val) {
+		t.Fatalf("unexpected len %d, %v", len(dt), err)
+	}
+}
+
 func BenchmarkName(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		b.StopTimer()